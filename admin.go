@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// 管理用のエンドポイントへのリクエストが Authorization ヘッダに付けるトークンの種類．
+const adminAuthScheme = "Bearer "
+
+// 管理用のエンドポイントのハンドラを受け取り，AdminToken による認証を加えたハンドラを戻り値として返す．
+//
+// AdminToken が設定されていない場合は 403 を，Authorization ヘッダのトークンが一致しない場合は 401 を返す．
+// トークンの比較にかかる時間から推測されないよう，比較は一定時間で行う．
+func (app *application) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if app.config.AdminToken == "" {
+			writeError(writer, http.StatusForbidden, "admin endpoints are disabled")
+			return
+		}
+
+		header := request.Header.Get("Authorization")
+		token, ok := strings.CutPrefix(header, adminAuthScheme)
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(app.config.AdminToken)) != 1 {
+			writer.Header().Set("WWW-Authenticate", strings.TrimSpace(adminAuthScheme))
+			writeError(writer, http.StatusUnauthorized, "invalid admin token")
+			return
+		}
+
+		next(writer, request)
+	}
+}
+
+// POST /admin/reload のレスポンスの形式．
+//
+// Themes は，読み込んだテーマの数．Images は，全てのテーマの画像の数の合計．
+type reloadResponse struct {
+	Themes int `json:"themes"`
+	Images int `json:"images"`
+}
+
+// POST /admin/reload を処理し，ImageDir の画像を読み込み直してテーマの一覧を差し替える．
+//
+// 読み込みに失敗した場合は，それまでのテーマの一覧を残して 500 を返す．
+// 遊んでいる途中のゲームの盤面はそのまま残り，差し替えた一覧は以降に始めるゲームから用いる．
+func (app *application) reloadHandler(writer http.ResponseWriter, request *http.Request) {
+	themes, err := loadThemes(app.config.ImageDir, app.config.urlFor(imageURLPrefix))
+	if err != nil {
+		logRequestError(request, "Cannot reload images", err)
+		writeError(writer, http.StatusInternalServerError, "cannot reload images")
+		return
+	}
+	app.themes.Store(&themes)
+
+	response := reloadResponse{Themes: len(themes)}
+	for _, images := range themes {
+		response.Images += len(images)
+	}
+	logInfo("Reloaded", response.Images, "images in", response.Themes, "themes")
+	writeJSON(writer, http.StatusOK, response)
+}
@@ -0,0 +1,864 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// JSON API のパスの接頭辞．
+const apiPathPrefix = "/api/"
+
+// 盤面の絵柄の組数の既定値と上限．
+const (
+	defaultPairs = 8
+	maxPairs     = 32
+)
+
+// 制限時間のあるゲームに指定できる秒数の上限．
+const maxTimeLimitSeconds = 3600
+
+// ゲームの始めに全てのカードの絵柄を見せる時間に指定できる秒数の上限．
+const maxRevealSeconds = 30
+
+// GET /api/leaderboard で返す成績の件数．
+const leaderboardTopCount = 10
+
+// 名前を指定せずにゲームを終えたプレイヤーの名前．
+const anonymousPlayerName = "名無し"
+
+// エラー時のレスポンスとして返す JSON の形式．
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// data を JSON に変換し，status と共にレスポンスとして書き込む．
+func writeJSON(writer http.ResponseWriter, status int, data any) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		logError("Cannot encode response", err)
+		http.Error(writer, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	writer.Write(body)
+}
+
+// エラーメッセージを JSON に変換し，status と共にレスポンスとして書き込む．
+func writeError(writer http.ResponseWriter, status int, message string) {
+	writeJSON(writer, status, errorResponse{Error: message})
+}
+
+// リクエストのメソッドが method であるか確認し，そうでなければ Allow ヘッダと共に 405 を書き込んで false を返す．
+//
+// method が GET の場合は，net/http と同じく HEAD も受け付ける．
+func requireMethod(writer http.ResponseWriter, request *http.Request, method string) bool {
+	if request.Method == method || (method == http.MethodGet && request.Method == http.MethodHead) {
+		return true
+	}
+
+	allow := method
+	if method == http.MethodGet {
+		allow = http.MethodGet + ", " + http.MethodHead
+	}
+	writer.Header().Set("Allow", allow)
+	writeError(writer, http.StatusMethodNotAllowed, fmt.Sprintf("method %s is not allowed, use %s", request.Method, method))
+	return false
+}
+
+// リクエストボディが JSON であることを Content-Type ヘッダで確認し，そうでなければその理由を表すエラーを返す．
+//
+// 呼び出し側は，エラーの場合に 415 を返すこと．
+func requireJSON(request *http.Request) error {
+	mediaType, _, err := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return errors.New("Content-Type must be application/json")
+	}
+	return nil
+}
+
+// 遊ばれているゲームの数が MaxActiveGames に達し，新しいゲームを始められないことを 503 として返す．
+//
+// 掃除で参照されないセッションが削除されれば始められるようになるため，Retry-After には SweepInterval を設定する．
+func (app *application) writeTooManyGames(writer http.ResponseWriter) {
+	retryAfter := max(int(time.Duration(app.config.SweepInterval).Seconds()), 1)
+	writer.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	writeError(writer, http.StatusServiceUnavailable, "too many active games, try again later")
+}
+
+// リクエストボディを JSON として解釈できなかった場合のエラーを返す．
+//
+// ボディが MaxRequestBytes を超えていた場合は 413 を，それ以外の場合は message を添えて 400 を返す．
+func writeDecodeError(writer http.ResponseWriter, err error, message string) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(writer, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body must not exceed %d bytes", tooLarge.Limit))
+		return
+	}
+	writeError(writer, http.StatusBadRequest, message)
+}
+
+// クエリパラメータ seconds を読み取り，ゲームの制限時間を戻り値として返す．
+//
+// 指定されていない場合は，制限時間が無いことを表す 0 を返す．値が不正な場合はエラーを返す．
+func timeLimitFromQuery(query url.Values) (time.Duration, error) {
+	if !query.Has("seconds") {
+		return 0, nil
+	}
+	seconds, err := strconv.Atoi(query.Get("seconds"))
+	if err != nil || seconds < 1 || seconds > maxTimeLimitSeconds {
+		return 0, fmt.Errorf("seconds must be an integer between 1 and %d", maxTimeLimitSeconds)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// クエリパラメータ revealSeconds を読み取り，ゲームの始めに全てのカードの絵柄を見せる時間を戻り値として返す．
+//
+// 指定されていない場合は，見せる時間が無いことを表す 0 を返す．値が不正な場合はエラーを返す．
+func revealPeriodFromQuery(query url.Values) (time.Duration, error) {
+	if !query.Has("revealSeconds") {
+		return 0, nil
+	}
+	seconds, err := strconv.Atoi(query.Get("revealSeconds"))
+	if err != nil || seconds < 1 || seconds > maxRevealSeconds {
+		return 0, fmt.Errorf("revealSeconds must be an integer between 1 and %d", maxRevealSeconds)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// クエリパラメータ spread を読み取り，盤面の並べ方の選択肢を戻り値として返す．
+//
+// spread が真の場合は，同じ絵柄のカードが隣り合わないよう並べる．値が真偽値として読めない場合はエラーを返す．
+func boardOptionsFromQuery(query url.Values) (BoardOptions, error) {
+	var options BoardOptions
+	if !query.Has("spread") {
+		return options, nil
+	}
+	spread, err := strconv.ParseBool(query.Get("spread"))
+	if err != nil {
+		return options, errors.New("spread must be true or false")
+	}
+	options.SpreadPairs = spread
+	return options, nil
+}
+
+// クエリパラメータ difficulty または pairs を読み取り，盤面の行数と列数を戻り値として返す．
+//
+// どちらも無い場合は defaultPairs 組の盤面とする．両方ある場合や値が不正な場合はエラーを返す．
+func gridFromQuery(query url.Values) (rows, cols int, err error) {
+	difficulty := query.Get("difficulty")
+	pairsValue := query.Get("pairs")
+	switch {
+	case difficulty != "" && pairsValue != "":
+		return 0, 0, errors.New("difficulty and pairs cannot be specified together")
+	case difficulty != "":
+		return gridForDifficulty(difficulty)
+	case pairsValue != "":
+		pairs, err := strconv.Atoi(pairsValue)
+		if err != nil || pairs < 1 || pairs > maxPairs {
+			return 0, 0, fmt.Errorf("pairs must be an integer between 1 and %d", maxPairs)
+		}
+		rows, cols = gridForPairs(pairs)
+		return rows, cols, nil
+	default:
+		rows, cols = gridForPairs(defaultPairs)
+		return rows, cols, nil
+	}
+}
+
+// GET /api/board を処理し，並べ替えた盤面を JSON として返す．
+//
+// クエリパラメータ difficulty で難易度を，pairs で絵柄の組数を，theme で絵柄のテーマを指定できる．
+// spread=true を指定すると，同じ絵柄のカードが隣り合わないよう並べる．
+// 不正な難易度や範囲外の組数，存在しないテーマ，テーマの画像が組数に満たない場合は 400 を返す．
+func (app *application) boardHandler(writer http.ResponseWriter, request *http.Request) {
+	if !requireMethod(writer, request, http.MethodGet) {
+		return
+	}
+
+	query := request.URL.Query()
+	rows, cols, err := gridFromQuery(query)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	options, err := boardOptionsFromQuery(query)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	images, ok := app.currentThemes()[query.Get("theme")]
+	if !ok {
+		writeError(writer, http.StatusBadRequest, fmt.Sprintf("unknown theme %q", query.Get("theme")))
+		return
+	}
+
+	board, err := NewBoard(images, rows, cols, app.random.child(), options)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(writer, http.StatusOK, board)
+}
+
+// テーマの名前，盤面の行数と列数，並べ方の選択肢を受け取り，そのテーマの絵柄を新しく並べ替えた盤面で始めるゲームを戻り値として返す．
+//
+// 始めたゲームの数は計測値に記録する．
+func (app *application) startGame(theme string, rows, cols int, options BoardOptions) (*Game, error) {
+	board, err := NewBoard(app.currentThemes()[theme], rows, cols, app.random.child(), options)
+	if err != nil {
+		return nil, err
+	}
+	game, err := NewGame(board)
+	if err != nil {
+		return nil, err
+	}
+	game.Theme = theme
+	game.setMismatchReset(app.config.mismatchResetDelay())
+	app.metrics.gamesStarted.Add(1)
+	return game, nil
+}
+
+// id のセッションで新しく始めるゲームに用いるテーマの名前を戻り値として返す．
+//
+// プレイヤーが選んだテーマを返す．選んだテーマが画像の読み込み直しで消えた場合は，既定のテーマを返す．
+func (app *application) sessionTheme(id string) string {
+	theme := app.sessions.theme(id)
+	if _, ok := app.currentThemes()[theme]; !ok {
+		return defaultTheme
+	}
+	return theme
+}
+
+// プレイヤーから見えるカードの状態．
+//
+// 裏になっているカードの絵柄は，全てのカードの絵柄を見せている間を除いて返さない．
+type cardView struct {
+	ImageURL string `json:"imageUrl,omitempty"`
+	FaceUp   bool   `json:"faceUp"`
+	Matched  bool   `json:"matched"`
+}
+
+// プレイヤーから見えるゲームの状態．
+type gameStateView struct {
+	Cards   []cardView `json:"cards"`
+	Moves   int        `json:"moves"`
+	Matches int        `json:"matches"`
+	Pairs   int        `json:"pairs"`
+}
+
+// ゲームを受け取り，プレイヤーから見える状態に変換して戻り値として返す．
+func newGameStateView(game *Game) gameStateView {
+	revealing := game.IsRevealing(time.Now())
+	cards := make([]cardView, len(game.Board.Cards))
+	for i, card := range game.Board.Cards {
+		faceUp := game.isFaceUp(i)
+		cards[i] = cardView{FaceUp: faceUp, Matched: card.Matched}
+		if faceUp || card.Matched || revealing {
+			cards[i].ImageURL = card.ImageURL
+		}
+	}
+
+	return gameStateView{
+		Cards:   cards,
+		Moves:   game.Moves,
+		Matches: game.Matches,
+		Pairs:   len(game.Board.Cards) / 2,
+	}
+}
+
+// POST /api/flip のリクエストボディの形式．
+//
+// Name は，ゲームを終えた場合にリーダーボードに記録するプレイヤーの名前．省略できる．記録する前に sanitizeName で整える．
+type flipRequest struct {
+	Card int    `json:"card"`
+	Name string `json:"name"`
+}
+
+// POST /api/flip のレスポンスの形式．
+//
+// JustMatched は，今回めくったカードで絵柄の組が揃ったかどうか．
+// Score は，ゲームを終えた場合の成績．終えていない場合は含めない．
+// ResetAfterMs は，揃わなかった2枚のカードをサーバーが裏に戻すまでのミリ秒数．自動で戻さない場合や揃わなかった2枚が無い場合は含めない．
+type flipResponse struct {
+	gameStateView
+	JustMatched bool   `json:"justMatched"`
+	Score       *Score `json:"score,omitempty"`
+
+	ResetAfterMs int64 `json:"resetAfterMs,omitempty"`
+}
+
+// POST /api/flip を処理し，セッションのゲームで指定されたカードをめくった結果を JSON として返す．
+//
+// セッションにゲームが無い場合は，新しいゲームを始めてからめくる．
+// ゲームを終えた場合は，その成績をリーダーボードに記録する．
+// 頻度の制限を超えた場合は，Retry-After ヘッダと共に 429 を返す．
+// 全てのカードの絵柄を見せている間は，見せ終わるまでの秒数を Retry-After ヘッダに付けて 409 を返す．
+// 名前が空白のみの場合や長すぎる場合は，カードをめくらずに 400 を返す．
+func (app *application) flipHandler(writer http.ResponseWriter, request *http.Request) {
+	if !requireMethod(writer, request, http.MethodPost) {
+		return
+	}
+
+	id := sessionIDFromContext(request.Context())
+
+	// 機械的に大量にめくられないよう，頻度を制限する．
+	allowed, retryAfter := app.sessions.allowFlip(id, app.config.FlipsPerSecond)
+	if !allowed {
+		writer.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		writeError(writer, http.StatusTooManyRequests, "too many flips, slow down")
+		return
+	}
+
+	err := requireJSON(request)
+	if err != nil {
+		writeError(writer, http.StatusUnsupportedMediaType, err.Error())
+		return
+	}
+	var body flipRequest
+	err = json.NewDecoder(request.Body).Decode(&body)
+	if err != nil {
+		writeDecodeError(writer, err, "request body must be JSON such as {\"card\": 0}")
+		return
+	}
+
+	// ゲームを終えてから名前を拒否することの無いよう，めくる前に名前を検証する．
+	name := anonymousPlayerName
+	if body.Name != "" {
+		name, err = sanitizeName(body.Name)
+		if err != nil {
+			writeError(writer, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	var response flipResponse
+	var dailyDate string
+	var unranked bool
+	var revealUntil time.Time
+	theme := app.sessionTheme(id)
+	createGame := func() (*Game, error) {
+		rows, cols := gridForPairs(defaultPairs)
+		return app.startGame(theme, rows, cols, BoardOptions{})
+	}
+	createErr := app.sessions.update(id, createGame, func(game *Game) {
+		response.JustMatched, err = game.Flip(body.Card)
+		if err == nil {
+			app.metrics.flips.Add(1)
+		}
+		response.gameStateView = newGameStateView(game)
+		if game.IsComplete() {
+			score := game.FinalScore()
+			response.Score = &score
+		}
+		if len(game.FaceUp) == 2 && !game.MismatchResetAt.IsZero() {
+			response.ResetAfterMs = time.Until(game.MismatchResetAt).Round(time.Millisecond).Milliseconds()
+		}
+		dailyDate = game.DailyDate
+		unranked = game.Unranked
+		revealUntil = game.RevealUntil
+	})
+	if errors.Is(createErr, errTooManyGames) {
+		app.writeTooManyGames(writer)
+		return
+	}
+	if createErr != nil {
+		logRequestError(request, "Cannot start game", createErr)
+		writeError(writer, http.StatusInternalServerError, "cannot start game")
+		return
+	}
+	if body.Name != "" {
+		app.sessions.setPlayerName(id, name)
+	}
+
+	// ゲームを終えた場合は成績を記録する．日替わりの盤面の成績は，セッションごとにその日の最初の成績のみを，その日のリーダーボードに記録する．
+	// 保存された状態から再開したゲームなど，記録しないゲームの成績はリーダーボードに記録しない．
+	if err == nil && response.JustMatched && response.Score != nil {
+		app.metrics.recordCompletion(time.Duration(response.Score.DurationSeconds * float64(time.Second)))
+		var saveErr error
+		switch {
+		case unranked:
+		case dailyDate != "":
+			if app.sessions.recordDaily(id, dailyDate) {
+				saveErr = app.dailyScores.Add(dailyDate, name, *response.Score)
+			}
+		default:
+			saveErr = app.leaderboard.Add(name, *response.Score)
+		}
+		if saveErr != nil {
+			logRequestError(request, "Cannot save score", saveErr)
+		}
+	}
+
+	switch {
+	case errors.Is(err, errCardOutOfRange):
+		writeError(writer, http.StatusBadRequest, err.Error())
+	case errors.Is(err, errCardUnavailable):
+		writeError(writer, http.StatusConflict, err.Error())
+	case errors.Is(err, errRevealing):
+		writer.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(revealUntil).Seconds()))))
+		writeError(writer, http.StatusConflict, err.Error())
+	case errors.Is(err, errTimeUp):
+		writeError(writer, http.StatusGone, err.Error())
+	default:
+		writeJSON(writer, http.StatusOK, response)
+	}
+}
+
+// GET /api/leaderboard を処理し，得点の高い順に上位の成績を JSON として返す．
+func (app *application) leaderboardHandler(writer http.ResponseWriter, request *http.Request) {
+	if !requireMethod(writer, request, http.MethodGet) {
+		return
+	}
+
+	top, err := app.leaderboard.Top(leaderboardTopCount)
+	if err != nil {
+		logRequestError(request, "Cannot read scores", err)
+		writeError(writer, http.StatusInternalServerError, "cannot read scores")
+		return
+	}
+	writeJSON(writer, http.StatusOK, top)
+}
+
+// POST /api/new のレスポンスの形式．
+//
+// TimeLimitSeconds は，制限時間のあるゲームの制限時間の秒数．制限時間が無ければ含めない．
+// RevealSeconds は，ゲームの始めに全てのカードの絵柄を見せる秒数．見せる時間が無ければ含めない．
+type newGameResponse struct {
+	Token string `json:"token"`
+	Rows  int    `json:"rows"`
+	Cols  int    `json:"cols"`
+	Cards int    `json:"cards"`
+
+	TimeLimitSeconds int `json:"timeLimitSeconds,omitempty"`
+	RevealSeconds    int `json:"revealSeconds,omitempty"`
+}
+
+// POST /api/new を処理し，セッションのゲームを新しく並べ替えた盤面のゲームに置き換える．
+//
+// 盤面の大きさと絵柄のテーマは現在のゲームと同じにする．盤面の大きさはクエリパラメータ difficulty または pairs で変更することもできる．
+// テーマの画像が絵柄の組数に満たない場合は 400 を返す．
+// クエリパラメータ seconds を指定すると，その秒数以内に終えなければならないゲームとする．
+// revealSeconds を指定すると，始めのその秒数の間は GET /api/status で全てのカードの絵柄を見せ，その間はカードをめくれない．制限時間はその後から数える．
+// spread=true を指定すると，同じ絵柄のカードが隣り合わないよう並べる．
+// セッションやゲームが無い場合は新しく作成する．遊ばれているゲームの数が MaxActiveGames に達している場合は 503 を返す．
+func (app *application) newGameHandler(writer http.ResponseWriter, request *http.Request) {
+	if !requireMethod(writer, request, http.MethodPost) {
+		return
+	}
+
+	id := sessionIDFromContext(request.Context())
+
+	query := request.URL.Query()
+	requested := query.Has("difficulty") || query.Has("pairs")
+	rows, cols, err := gridFromQuery(query)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit, err := timeLimitFromQuery(query)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	reveal, err := revealPeriodFromQuery(query)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	options, err := boardOptionsFromQuery(query)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	theme := app.sessionTheme(id)
+	game, err := app.sessions.replace(id, func(current *Game) (*Game, error) {
+		if current != nil && !requested {
+			rows, cols = current.Board.Rows, current.Board.Cols
+		}
+		game, err := app.startGame(theme, rows, cols, options)
+		if err != nil {
+			return nil, err
+		}
+		if reveal > 0 {
+			game.setRevealPeriod(reveal)
+		}
+		if limit > 0 {
+			game.setTimeLimit(limit)
+		}
+		return game, nil
+	})
+	if errors.Is(err, errNotEnoughImages) {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errors.Is(err, errTooManyGames) {
+		app.writeTooManyGames(writer)
+		return
+	}
+	if err != nil {
+		logRequestError(request, "Cannot start game", err)
+		writeError(writer, http.StatusInternalServerError, "cannot start game")
+		return
+	}
+
+	writeJSON(writer, http.StatusOK, newGameResponse{
+		Token: game.Token,
+		Rows:  game.Board.Rows,
+		Cols:  game.Board.Cols,
+		Cards: len(game.Board.Cards),
+
+		TimeLimitSeconds: int(limit / time.Second),
+		RevealSeconds:    int(reveal / time.Second),
+	})
+}
+
+// POST /api/theme のリクエストボディの形式．
+type themeRequest struct {
+	Theme string `json:"theme"`
+}
+
+// POST /api/theme のレスポンスの形式．
+//
+// Theme は，セッションに記録した，以降に始めるゲームに用いるテーマの名前．
+type themeResponse struct {
+	Theme string `json:"theme"`
+}
+
+// 存在しないテーマが指定された場合のレスポンスの形式．
+//
+// Themes は，選べるテーマの名前の一覧．
+type themeErrorResponse struct {
+	Error  string   `json:"error"`
+	Themes []string `json:"themes"`
+}
+
+// POST /api/theme を処理し，指定されたテーマをセッションのプレイヤーが選んだテーマとして記録する．
+//
+// 遊んでいるゲームはそのまま続けられる．選んだテーマは，以降に POST /api/new などで始めるゲームに引き継がれる．
+// セッションが無い場合は，そのテーマの絵柄で並べた盤面のゲームを始める．
+// 存在しないテーマには選べるテーマの一覧と共に 400 を返す．ゲームを始める際にテーマの画像が絵柄の組数に満たない場合も 400 を返す．
+func (app *application) themeHandler(writer http.ResponseWriter, request *http.Request) {
+	if !requireMethod(writer, request, http.MethodPost) {
+		return
+	}
+
+	id := sessionIDFromContext(request.Context())
+
+	err := requireJSON(request)
+	if err != nil {
+		writeError(writer, http.StatusUnsupportedMediaType, err.Error())
+		return
+	}
+	var body themeRequest
+	err = json.NewDecoder(request.Body).Decode(&body)
+	if err != nil {
+		writeDecodeError(writer, err, "request body must be JSON such as {\"theme\": \"animals\"}")
+		return
+	}
+	themes := app.currentThemes()
+	if _, ok := themes[body.Theme]; !ok {
+		writeJSON(writer, http.StatusBadRequest, themeErrorResponse{
+			Error:  fmt.Sprintf("unknown theme %q", body.Theme),
+			Themes: themes.names(),
+		})
+		return
+	}
+
+	err = app.sessions.setTheme(id, body.Theme, func() (*Game, error) {
+		rows, cols := gridForPairs(defaultPairs)
+		return app.startGame(body.Theme, rows, cols, BoardOptions{})
+	})
+	if errors.Is(err, errNotEnoughImages) {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errors.Is(err, errTooManyGames) {
+		app.writeTooManyGames(writer)
+		return
+	}
+	if err != nil {
+		logRequestError(request, "Cannot start game", err)
+		writeError(writer, http.StatusInternalServerError, "cannot start game")
+		return
+	}
+
+	writeJSON(writer, http.StatusOK, themeResponse{Theme: body.Theme})
+}
+
+// POST /api/hint のレスポンスの形式．
+//
+// Cards は，揃えていない組の2枚のカードの番号．それ以外のカードの情報は含めない．
+type hintResponse struct {
+	Cards     [2]int `json:"cards"`
+	HintsUsed int    `json:"hintsUsed"`
+	HintsLeft int    `json:"hintsLeft"`
+}
+
+// POST /api/hint を処理し，セッションのゲームで揃えていない組を1つ選んで，その2枚のカードの番号を JSON として返す．
+//
+// ゲームが無い場合は 404 を，ヒントの使用回数が上限に達している場合は 429 を，揃えていない組が無い場合は 409 を，
+// 制限時間を過ぎている場合は 410 を返す．
+func (app *application) hintHandler(writer http.ResponseWriter, request *http.Request) {
+	if !requireMethod(writer, request, http.MethodPost) {
+		return
+	}
+
+	id := sessionIDFromContext(request.Context())
+
+	var response hintResponse
+	var err error
+	found := app.sessions.lookup(id, func(game *Game) {
+		response.Cards[0], response.Cards[1], err = game.Hint(app.config.MaxHints, app.random.child())
+		response.HintsUsed = game.HintsUsed
+		response.HintsLeft = max(app.config.MaxHints-game.HintsUsed, 0)
+	})
+
+	switch {
+	case !found:
+		writeError(writer, http.StatusNotFound, "no game in this session")
+	case errors.Is(err, errNoHintsLeft):
+		writeError(writer, http.StatusTooManyRequests, err.Error())
+	case errors.Is(err, errNothingToHint):
+		writeError(writer, http.StatusConflict, err.Error())
+	case errors.Is(err, errTimeUp):
+		writeError(writer, http.StatusGone, err.Error())
+	default:
+		writeJSON(writer, http.StatusOK, response)
+	}
+}
+
+// GET /api/status のレスポンスの形式．
+//
+// Unmatched は，まだ揃えていない絵柄の組数．
+// ElapsedSeconds は，ゲームを始めてからの秒数．ゲームを終えた場合は終えるまでの秒数．
+// RemainingSeconds は，制限時間のあるゲームの残り秒数．制限時間が無ければ含めない．
+// Failed は，制限時間内に全ての組を揃えられなかったかどうか．
+// Revealing は，ゲームの始めに全てのカードの絵柄を見せている最中かどうか．
+// Cards は，絵柄を見せている最中に限り返す，絵柄を含む全てのカード．
+type statusResponse struct {
+	Pairs          int     `json:"pairs"`
+	Matches        int     `json:"matches"`
+	Unmatched      int     `json:"unmatched"`
+	Moves          int     `json:"moves"`
+	HintsUsed      int     `json:"hintsUsed"`
+	ElapsedSeconds float64 `json:"elapsedSeconds"`
+	Complete       bool    `json:"complete"`
+	Failed         bool    `json:"failed"`
+	Revealing      bool    `json:"revealing"`
+
+	RemainingSeconds *float64   `json:"remainingSeconds,omitempty"`
+	Cards            []cardView `json:"cards,omitempty"`
+}
+
+// 時刻 now におけるゲームの状態を表す ETag を戻り値として返す．
+//
+// ゲームのトークン，状態の番号，手数，絵柄を見せている最中かどうかから作る．
+// 経過時間や残り時間は含めないため，ETag の一致は状態が変わっていないことのみを表す．
+func gameETag(game *Game, now time.Time) string {
+	return fmt.Sprintf(`"%s-%x-%x-%t"`, game.Token, game.Version, game.Moves, game.IsRevealing(now))
+}
+
+// GET /api/status を処理し，セッションのゲームの進み具合をカードの絵柄を含めずに JSON として返す．
+//
+// ただし，全てのカードの絵柄を見せている間は，それらを覚えられるよう絵柄を含む全てのカードも返す．
+// 経過時間はゲームを始めた時刻から求めるため，再接続した後に問い合わせても正しい値になる．
+// 制限時間のあるゲームでは，クライアントが残り時間を表示できるよう残り秒数も返す．
+// 繰り返し問い合わせるクライアントのため，ゲームの状態から作った弱い ETag を付け，
+// If-None-Match ヘッダがそれと一致する場合は 304 を返す．経過時間や残り時間はクライアント側で進めること．
+// ゲームが無い場合は 404 を返す．
+func (app *application) statusHandler(writer http.ResponseWriter, request *http.Request) {
+	if !requireMethod(writer, request, http.MethodGet) {
+		return
+	}
+
+	id := sessionIDFromContext(request.Context())
+
+	var response statusResponse
+	var etag string
+	found := app.sessions.lookup(id, func(game *Game) {
+		now := time.Now()
+		game.checkDeadline(now)
+		game.resetMismatch(now)
+		etag = gameETag(game, now)
+		pairs := len(game.Board.Cards) / 2
+		response = statusResponse{
+			Pairs:          pairs,
+			Matches:        game.Matches,
+			Unmatched:      pairs - game.Matches,
+			Moves:          game.Moves,
+			HintsUsed:      game.HintsUsed,
+			ElapsedSeconds: game.Elapsed(now).Seconds(),
+			Complete:       game.IsComplete(),
+			Failed:         game.Failed,
+			Revealing:      game.IsRevealing(now),
+		}
+		if game.IsTimed() {
+			remaining := game.Remaining(now).Seconds()
+			response.RemainingSeconds = &remaining
+		}
+		if response.Revealing {
+			response.Cards = newGameStateView(game).Cards
+		}
+	})
+	if !found {
+		writeError(writer, http.StatusNotFound, "no game in this session")
+		return
+	}
+
+	writer.Header().Set("ETag", "W/"+etag)
+	writer.Header().Set("Cache-Control", "no-cache")
+	if etagMatches(request.Header.Get("If-None-Match"), etag) {
+		writer.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeJSON(writer, http.StatusOK, response)
+}
+
+// GET /api/game/{id} を処理し，トークンが id のゲームの状態を保存用の JSON として返す．
+//
+// そのようなゲームが無い場合は 404 を返す．
+func (app *application) saveGameHandler(writer http.ResponseWriter, request *http.Request) {
+	if !requireMethod(writer, request, http.MethodGet) {
+		return
+	}
+
+	var saved savedGame
+	found := app.sessions.lookupToken(request.PathValue("id"), func(game *Game) {
+		saved = game.save()
+	})
+	if !found {
+		writeError(writer, http.StatusNotFound, "no game with this id")
+		return
+	}
+	writeJSON(writer, http.StatusOK, saved)
+}
+
+// GET /api/game/{id}/replay のレスポンスに含める1回のめくり方．
+//
+// AtSeconds は，ゲームを始めてからめくるまでの秒数．
+type moveView struct {
+	CardIndex int     `json:"cardIndex"`
+	AtSeconds float64 `json:"atSeconds"`
+	Matched   bool    `json:"matched"`
+}
+
+// GET /api/game/{id}/replay のレスポンスの形式．
+//
+// Board は，全ての絵柄を含む盤面．ゲームを終えた後に限り返すため，絵柄を明かしてよい．
+// Truncated は，めくり方が maxReplayMoves 件を超えた場合や保存された状態から再開した場合など，記録が一部のめくりを欠いているかどうか．
+type replayResponse struct {
+	Board     *Board     `json:"board"`
+	Moves     []moveView `json:"moves"`
+	Score     Score      `json:"score"`
+	Truncated bool       `json:"truncated"`
+}
+
+// GET /api/game/{id}/replay を処理し，トークンが id のゲームのめくり方の記録を JSON として返す．
+//
+// 記録は全ての組を揃えた後に限り返す．そのようなゲームが無い場合は 404 を，ゲームを終えていない場合は 409 を返す．
+func (app *application) replayHandler(writer http.ResponseWriter, request *http.Request) {
+	if !requireMethod(writer, request, http.MethodGet) {
+		return
+	}
+
+	var response replayResponse
+	complete := false
+	found := app.sessions.lookupToken(request.PathValue("id"), func(game *Game) {
+		complete = game.IsComplete()
+		if !complete {
+			return
+		}
+		board := *game.Board
+		board.Cards = append([]Card(nil), game.Board.Cards...)
+		response.Board = &board
+		response.Moves = make([]moveView, len(game.Replay))
+		for i, move := range game.Replay {
+			response.Moves[i] = moveView{CardIndex: move.CardIndex, AtSeconds: move.At.Seconds(), Matched: move.Matched}
+		}
+		response.Score = game.FinalScore()
+		response.Truncated = game.ReplayTruncated
+	})
+
+	switch {
+	case !found:
+		writeError(writer, http.StatusNotFound, "no game with this id")
+	case !complete:
+		writeError(writer, http.StatusConflict, "replay is available once the game is complete")
+	default:
+		writeJSON(writer, http.StatusOK, response)
+	}
+}
+
+// POST /api/game を処理し，保存されたゲームの状態から再開したゲームをセッションのゲームとする．
+//
+// 保存された状態が読めない場合や矛盾がある場合，保存されたテーマが存在しない場合は 400 を返す．
+func (app *application) restoreGameHandler(writer http.ResponseWriter, request *http.Request) {
+	if !requireMethod(writer, request, http.MethodPost) {
+		return
+	}
+
+	id := sessionIDFromContext(request.Context())
+
+	err := requireJSON(request)
+	if err != nil {
+		writeError(writer, http.StatusUnsupportedMediaType, err.Error())
+		return
+	}
+	var saved savedGame
+	err = json.NewDecoder(request.Body).Decode(&saved)
+	if err != nil {
+		writeDecodeError(writer, err, "request body must be a saved game")
+		return
+	}
+
+	images, ok := app.currentThemes()[saved.Theme]
+	if !ok {
+		writeError(writer, http.StatusBadRequest, fmt.Sprintf("unknown theme %q", saved.Theme))
+		return
+	}
+	err = saved.dealHidden(app.random.child())
+	if err == nil {
+		err = saved.validate(images)
+	}
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	game, err := app.sessions.replace(id, func(current *Game) (*Game, error) {
+		game, err := restoreGame(saved, images)
+		if err != nil {
+			return nil, err
+		}
+		game.setMismatchReset(app.config.mismatchResetDelay())
+		return game, nil
+	})
+	if errors.Is(err, errTooManyGames) {
+		app.writeTooManyGames(writer)
+		return
+	}
+	if err != nil {
+		logRequestError(request, "Cannot restore game", err)
+		writeError(writer, http.StatusInternalServerError, "cannot restore game")
+		return
+	}
+
+	writeJSON(writer, http.StatusOK, newGameResponse{
+		Token: game.Token,
+		Rows:  game.Board.Rows,
+		Cols:  game.Board.Cols,
+		Cards: len(game.Board.Cards),
+	})
+}
@@ -0,0 +1,711 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// テスト用の設定を戻り値として返す．
+//
+// 成績はテストごとの一時ディレクトリに保存し，カードをめくる頻度は制限しない．
+func newTestConfig(t *testing.T) *Configuration {
+	t.Helper()
+	config := DefaultConfiguration()
+	config.ScoresFile = filepath.Join(t.TempDir(), "scores.json")
+	config.FlipsPerSecond = 0
+	return config
+}
+
+// httptest で起動したテスト用のサーバー．
+type testServer struct {
+	t      *testing.T
+	app    *application
+	server *httptest.Server
+}
+
+// config の設定でリクエストの処理に用いる状態を用意する．成績の保存先はテストの終了時に閉じる．
+func newTestApplication(t *testing.T, config *Configuration) *application {
+	t.Helper()
+	scores, err := openScoreStore(config.ScoreBackend, config.ScoresFile)
+	if err != nil {
+		t.Fatalf("openScoreStore: %v", err)
+	}
+	app, err := newApplication(config, scores)
+	if err != nil {
+		t.Fatalf("newApplication: %v", err)
+	}
+	t.Cleanup(func() {
+		app.dailyScores.Close()
+		scores.Close()
+	})
+	return app
+}
+
+// config の設定でテスト用のサーバーを起動する．サーバーと成績の保存先はテストの終了時に閉じる．
+func newTestServer(t *testing.T, config *Configuration) *testServer {
+	t.Helper()
+	app := newTestApplication(t, config)
+	server := httptest.NewServer(newRouter(app))
+	t.Cleanup(server.Close)
+	return &testServer{t: t, app: app, server: server}
+}
+
+// セッションのクッキーを保持する，1人のプレイヤーとしてのクライアントを戻り値として返す．
+func (server *testServer) newClient() *http.Client {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		server.t.Fatalf("cookiejar.New: %v", err)
+	}
+	return &http.Client{Jar: jar}
+}
+
+// client から method と path のリクエストを送り，レスポンスを戻り値として返す．
+//
+// body が nil でなければ JSON に変換してリクエストボディとする．header の各組はリクエストのヘッダに加える．
+func (server *testServer) do(client *http.Client, method, path string, body any, header ...string) *http.Response {
+	server.t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			server.t.Fatalf("json.Marshal: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	request, err := http.NewRequest(method, server.server.URL+path, reader)
+	if err != nil {
+		server.t.Fatalf("http.NewRequest: %v", err)
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		request.Header.Set(header[i], header[i+1])
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		server.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	server.t.Cleanup(func() { response.Body.Close() })
+	return response
+}
+
+// レスポンスボディを読み出し，文字列として戻り値として返す．
+func readBody(t *testing.T, response *http.Response) string {
+	t.Helper()
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatalf("reading body: %v", err)
+	}
+	return string(data)
+}
+
+// レスポンスボディを JSON として value に読み出す．
+func decodeBody(t *testing.T, response *http.Response, value any) {
+	t.Helper()
+	err := json.NewDecoder(response.Body).Decode(value)
+	if err != nil {
+		t.Fatalf("decoding body: %v", err)
+	}
+}
+
+// テーマの名前ごとの画像の枚数を受け取り，1x1 の PNG 画像を置いた画像ディレクトリを作ってそのパスを戻り値として返す．
+//
+// 名前が空のテーマの画像はディレクトリ直下に，それ以外はその名前のサブディレクトリに置く．
+func newTestImageDir(t *testing.T, themes map[string]int) string {
+	t.Helper()
+	dir := t.TempDir()
+	for theme, count := range themes {
+		themeDir := filepath.Join(dir, theme)
+		err := os.MkdirAll(themeDir, 0o755)
+		if err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		}
+		for i := range count {
+			var buffer bytes.Buffer
+			err := png.Encode(&buffer, image.NewGray(image.Rect(0, 0, 1, 1)))
+			if err == nil {
+				err = os.WriteFile(filepath.Join(themeDir, fmt.Sprintf("%02d.png", i)), buffer.Bytes(), 0o644)
+			}
+			if err != nil {
+				t.Fatalf("writing test image: %v", err)
+			}
+		}
+	}
+	return dir
+}
+
+// 組ごとの ID の列を受け取り，その順に1行に並べた盤面を戻り値として返す．
+func newTestBoard(ids ...int) *Board {
+	cards := make([]Card, len(ids))
+	for i, id := range ids {
+		cards[i] = Card{ID: id, ImageURL: fmt.Sprintf("/images/%02d.png", id)}
+	}
+	return &Board{Rows: 1, Cols: len(ids), Cards: cards}
+}
+
+// GET /game が，セッションのゲームの盤面を表示するページを返すことを確認する．
+func TestProcessGame(t *testing.T) {
+	server := newTestServer(t, newTestConfig(t))
+
+	tests := []struct {
+		name     string
+		language string
+		want     []string
+	}{
+		{name: "japanese by default", want: []string{`<html lang="ja">`, `data-rows="4"`, `data-cols="4"`, "名無し 様"}},
+		{name: "english", language: "en-US,en;q=0.9", want: []string{`<html lang="en">`, `data-rows="4"`, "Welcome, Anonymous."}},
+		{name: "unsupported language", language: "fr", want: []string{`<html lang="ja">`}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := server.do(server.newClient(), http.MethodGet, "/game", nil, "Accept-Language", test.language)
+			if response.StatusCode != http.StatusOK {
+				t.Fatalf("status = %d, want %d", response.StatusCode, http.StatusOK)
+			}
+			if got := response.Header.Get("Content-Type"); !strings.HasPrefix(got, "text/html") {
+				t.Errorf("Content-Type = %q, want text/html", got)
+			}
+			body := readBody(t, response)
+			for _, want := range test.want {
+				if !strings.Contains(body, want) {
+					t.Errorf("body does not contain %q", want)
+				}
+			}
+		})
+	}
+}
+
+// GET /game を繰り返しても，同じセッションでは同じゲームを表示することを確認する．
+func TestProcessGameKeepsSessionGame(t *testing.T) {
+	server := newTestServer(t, newTestConfig(t))
+	client := server.newClient()
+
+	first := readBody(t, server.do(client, http.MethodGet, "/game", nil))
+	second := readBody(t, server.do(client, http.MethodGet, "/game", nil))
+	token := func(body string) string {
+		_, after, _ := strings.Cut(body, `data-token="`)
+		value, _, _ := strings.Cut(after, `"`)
+		return value
+	}
+	if token(first) == "" || token(first) != token(second) {
+		t.Errorf("tokens = %q and %q, want the same non-empty token", token(first), token(second))
+	}
+}
+
+// GET /api/board が，クエリパラメータに応じた盤面か 400 を返すことを確認する．
+func TestBoardHandler(t *testing.T) {
+	server := newTestServer(t, newTestConfig(t))
+
+	tests := []struct {
+		query      string
+		wantStatus int
+		wantRows   int
+		wantCols   int
+	}{
+		{query: "", wantStatus: http.StatusOK, wantRows: 4, wantCols: 4},
+		{query: "?difficulty=easy", wantStatus: http.StatusOK, wantRows: 3, wantCols: 4},
+		{query: "?difficulty=hard", wantStatus: http.StatusOK, wantRows: 6, wantCols: 6},
+		{query: "?pairs=1", wantStatus: http.StatusOK, wantRows: 1, wantCols: 2},
+		{query: "?pairs=2&spread=true", wantStatus: http.StatusOK, wantRows: 2, wantCols: 2},
+		{query: "?difficulty=impossible", wantStatus: http.StatusBadRequest},
+		{query: "?pairs=0", wantStatus: http.StatusBadRequest},
+		{query: "?pairs=33", wantStatus: http.StatusBadRequest},
+		{query: "?pairs=x", wantStatus: http.StatusBadRequest},
+		{query: "?difficulty=easy&pairs=2", wantStatus: http.StatusBadRequest},
+		{query: "?spread=maybe", wantStatus: http.StatusBadRequest},
+		{query: "?theme=missing", wantStatus: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			response := server.do(server.newClient(), http.MethodGet, "/api/board"+test.query, nil)
+			if response.StatusCode != test.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", response.StatusCode, test.wantStatus, readBody(t, response))
+			}
+			if test.wantStatus != http.StatusOK {
+				return
+			}
+			var board Board
+			decodeBody(t, response, &board)
+			if board.Rows != test.wantRows || board.Cols != test.wantCols || len(board.Cards) != test.wantRows*test.wantCols {
+				t.Errorf("board is %dx%d with %d cards, want %dx%d", board.Rows, board.Cols, len(board.Cards), test.wantRows, test.wantCols)
+			}
+			if err := validatePairs(board.Cards); err != nil {
+				t.Errorf("validatePairs: %v", err)
+			}
+		})
+	}
+}
+
+// Game.Flip が，めくる順に応じて組を揃え，手数を数え，めくれないカードを拒むことを確認する．
+func TestGameFlip(t *testing.T) {
+	tests := []struct {
+		name        string
+		flips       []int
+		wantMatched bool
+		wantErr     error
+		wantMoves   int
+		wantMatches int
+		wantFaceUp  []int
+	}{
+		{name: "first card", flips: []int{0}, wantFaceUp: []int{0}},
+		{name: "matching pair", flips: []int{0, 2}, wantMatched: true, wantMoves: 1, wantMatches: 1},
+		{name: "mismatched pair stays face up", flips: []int{0, 1}, wantMoves: 1, wantFaceUp: []int{0, 1}},
+		{name: "next flip turns mismatch back", flips: []int{0, 1, 3}, wantMoves: 1, wantFaceUp: []int{3}},
+		{name: "same card twice", flips: []int{0, 0}, wantErr: errCardUnavailable, wantFaceUp: []int{0}},
+		{name: "matched card", flips: []int{0, 2, 0}, wantErr: errCardUnavailable, wantMoves: 1, wantMatches: 1},
+		{name: "out of range", flips: []int{4}, wantErr: errCardOutOfRange},
+		{name: "negative", flips: []int{-1}, wantErr: errCardOutOfRange},
+		{name: "complete game", flips: []int{0, 2, 1, 3}, wantMatched: true, wantMoves: 2, wantMatches: 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			game, err := NewGame(newTestBoard(0, 1, 0, 1))
+			if err != nil {
+				t.Fatalf("NewGame: %v", err)
+			}
+			var matched bool
+			for _, card := range test.flips {
+				matched, err = game.Flip(card)
+			}
+			if matched != test.wantMatched || !errors.Is(err, test.wantErr) {
+				t.Errorf("last flip = (%t, %v), want (%t, %v)", matched, err, test.wantMatched, test.wantErr)
+			}
+			if game.Moves != test.wantMoves || game.Matches != test.wantMatches {
+				t.Errorf("moves, matches = %d, %d, want %d, %d", game.Moves, game.Matches, test.wantMoves, test.wantMatches)
+			}
+			if !slices.Equal(game.FaceUp, test.wantFaceUp) {
+				t.Errorf("face up = %v, want %v", game.FaceUp, test.wantFaceUp)
+			}
+			if complete := game.Matches == 2; game.IsComplete() != complete || game.FinishedAt.IsZero() == complete {
+				t.Errorf("IsComplete = %t with FinishedAt %v", game.IsComplete(), game.FinishedAt)
+			}
+		})
+	}
+}
+
+// POST /api/flip が，めくった結果か不正なリクエストに対するエラーを返すことを確認する．
+func TestFlipHandler(t *testing.T) {
+	server := newTestServer(t, newTestConfig(t))
+
+	tests := []struct {
+		name       string
+		body       any
+		wantStatus int
+	}{
+		{name: "valid card", body: flipRequest{Card: 0}, wantStatus: http.StatusOK},
+		{name: "out of range", body: flipRequest{Card: 99}, wantStatus: http.StatusBadRequest},
+		{name: "not an object", body: []int{1}, wantStatus: http.StatusBadRequest},
+		{name: "blank name", body: flipRequest{Card: 0, Name: "   "}, wantStatus: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := server.do(server.newClient(), http.MethodPost, "/api/flip", test.body)
+			if response.StatusCode != test.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", response.StatusCode, test.wantStatus, readBody(t, response))
+			}
+			if test.wantStatus != http.StatusOK {
+				return
+			}
+			var flipped flipResponse
+			decodeBody(t, response, &flipped)
+			if len(flipped.Cards) != 2*defaultPairs || !flipped.Cards[0].FaceUp || flipped.Cards[0].ImageURL == "" {
+				t.Errorf("card 0 is not face up with its picture: %+v", flipped.Cards[0])
+			}
+			for i, card := range flipped.Cards[1:] {
+				if card.FaceUp || card.ImageURL != "" {
+					t.Errorf("card %d reveals %+v", i+1, card)
+				}
+			}
+		})
+	}
+}
+
+// 同じセッションで最初から最後までめくると，成績が返されリーダーボードに記録されることを確認する．
+func TestFlipHandlerCompletesGame(t *testing.T) {
+	server := newTestServer(t, newTestConfig(t))
+	client := server.newClient()
+
+	var created newGameResponse
+	decodeBody(t, server.do(client, http.MethodPost, "/api/new?pairs=2", nil), &created)
+	var board *Board
+	server.app.sessions.lookupToken(created.Token, func(game *Game) {
+		board = game.Board
+	})
+
+	var last flipResponse
+	for _, move := range board.Solve() {
+		response := server.do(client, http.MethodPost, "/api/flip", flipRequest{Card: move.CardIndex, Name: "tester"})
+		if response.StatusCode != http.StatusOK {
+			t.Fatalf("flip %d: status %d: %s", move.CardIndex, response.StatusCode, readBody(t, response))
+		}
+		last = flipResponse{}
+		decodeBody(t, response, &last)
+	}
+	if last.Score == nil || last.Score.Moves != 2 {
+		t.Fatalf("score = %+v, want 2 moves", last.Score)
+	}
+
+	var entries []LeaderboardEntry
+	decodeBody(t, server.do(client, http.MethodGet, "/api/leaderboard", nil), &entries)
+	if len(entries) != 1 || entries[0].Name != "tester" || entries[0].Score != *last.Score {
+		t.Errorf("leaderboard = %+v, want the finished score of tester", entries)
+	}
+}
+
+// POST /api/theme で選んだテーマが，遊んでいるゲームを残したまま，以降に始めるゲームに引き継がれることを確認する．
+func TestThemePersistsAcrossNewGames(t *testing.T) {
+	config := newTestConfig(t)
+	config.ImageDir = newTestImageDir(t, map[string]int{"": defaultPairs, "animals": defaultPairs})
+	server := newTestServer(t, config)
+	client := server.newClient()
+
+	themeOf := func(token string) string {
+		theme := "missing"
+		server.app.sessions.lookupToken(token, func(game *Game) {
+			theme = game.Theme
+			for _, card := range game.Board.Cards {
+				if (game.Theme == "animals") != strings.HasPrefix(card.ImageURL, "/images/animals/") {
+					t.Errorf("card %q does not belong to theme %q", card.ImageURL, game.Theme)
+				}
+			}
+		})
+		return theme
+	}
+
+	var started newGameResponse
+	decodeBody(t, server.do(client, http.MethodPost, "/api/new", nil), &started)
+	response := server.do(client, http.MethodPost, "/api/theme", themeRequest{Theme: "animals"})
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("POST /api/theme: status %d: %s", response.StatusCode, readBody(t, response))
+	}
+	if got := themeOf(started.Token); got != defaultTheme {
+		t.Errorf("game in progress has theme %q after choosing a theme, want it kept", got)
+	}
+
+	// 日替わりの盤面は既定のテーマで並べるが，選んだテーマは失われない．
+	server.do(client, http.MethodPost, "/api/daily", nil)
+	for _, path := range []string{"/api/new", "/api/new?difficulty=easy"} {
+		var created newGameResponse
+		decodeBody(t, server.do(client, http.MethodPost, path, nil), &created)
+		if got := themeOf(created.Token); got != "animals" {
+			t.Errorf("POST %s started a game with theme %q, want %q", path, got, "animals")
+		}
+	}
+
+	response = server.do(client, http.MethodPost, "/api/theme", themeRequest{Theme: "missing"})
+	if response.StatusCode != http.StatusBadRequest {
+		t.Errorf("unknown theme: status = %d, want %d", response.StatusCode, http.StatusBadRequest)
+	}
+}
+
+// セッションの無いプレイヤーが POST /api/theme で選んだテーマが，POST /api/flip で自動的に始めるゲームにも用いられることを確認する．
+func TestThemeAppliesToAutoCreatedGames(t *testing.T) {
+	config := newTestConfig(t)
+	config.ImageDir = newTestImageDir(t, map[string]int{"": defaultPairs, "animals": defaultPairs})
+	server := newTestServer(t, config)
+	client := server.newClient()
+
+	server.do(client, http.MethodPost, "/api/theme", themeRequest{Theme: "animals"})
+	var flipped flipResponse
+	decodeBody(t, server.do(client, http.MethodPost, "/api/flip", flipRequest{Card: 0}), &flipped)
+	if got := flipped.Cards[0].ImageURL; !strings.HasPrefix(got, "/images/animals/") {
+		t.Errorf("flipped card %q, want a picture from the animals theme", got)
+	}
+}
+
+// 各 API が決められたメソッドのみを受け付け，それ以外には Allow ヘッダ付きの 405 を返すことを確認する．
+func TestAPIMethods(t *testing.T) {
+	server := newTestServer(t, newTestConfig(t))
+	client := server.newClient()
+	var created newGameResponse
+	decodeBody(t, server.do(client, http.MethodPost, "/api/new", nil), &created)
+
+	getOnly := http.MethodGet + ", " + http.MethodHead
+	tests := []struct {
+		path  string
+		allow string
+	}{
+		{path: "/api/board", allow: getOnly},
+		{path: "/api/flip", allow: http.MethodPost},
+		{path: "/api/new", allow: http.MethodPost},
+		{path: "/api/theme", allow: http.MethodPost},
+		{path: "/api/theme/default/sprite", allow: getOnly},
+		{path: "/api/theme/default/sprite.png", allow: getOnly},
+		{path: "/api/hint", allow: http.MethodPost},
+		{path: "/api/status", allow: getOnly},
+		{path: "/api/game/" + created.Token, allow: getOnly},
+		{path: "/api/game/" + created.Token + "/replay", allow: getOnly},
+		{path: "/api/game/" + created.Token + "/result.png", allow: getOnly},
+		{path: "/api/game", allow: http.MethodPost},
+		{path: "/api/leaderboard", allow: getOnly},
+		{path: "/api/daily", allow: http.MethodPost},
+		{path: "/api/daily/leaderboard", allow: getOnly},
+		{path: "/api/options", allow: getOnly},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			for _, method := range []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodDelete} {
+				response := server.do(client, method, test.path, struct{}{})
+				allowed := strings.Contains(test.allow, method)
+				switch {
+				case allowed && response.StatusCode == http.StatusMethodNotAllowed:
+					t.Errorf("%s: status %d, want the method to be allowed", method, response.StatusCode)
+				case !allowed && response.StatusCode != http.StatusMethodNotAllowed:
+					t.Errorf("%s: status %d, want %d", method, response.StatusCode, http.StatusMethodNotAllowed)
+				case !allowed && response.Header.Get("Allow") != test.allow:
+					t.Errorf("%s: Allow = %q, want %q", method, response.Header.Get("Allow"), test.allow)
+				}
+			}
+		})
+	}
+}
+
+// JSON のボディを受け取る API が，Content-Type が application/json でないリクエストに 415 を返すことを確認する．
+func TestAPIRequiresJSON(t *testing.T) {
+	server := newTestServer(t, newTestConfig(t))
+	client := server.newClient()
+
+	for _, path := range []string{"/api/flip", "/api/theme", "/api/game"} {
+		for _, contentType := range []string{"", "text/plain", "application/x-www-form-urlencoded", "application/json; charset=utf-8"} {
+			t.Run(path+" "+contentType, func(t *testing.T) {
+				request, err := http.NewRequest(http.MethodPost, server.server.URL+path, strings.NewReader(`{}`))
+				if err != nil {
+					t.Fatalf("http.NewRequest: %v", err)
+				}
+				if contentType != "" {
+					request.Header.Set("Content-Type", contentType)
+				}
+				response, err := client.Do(request)
+				if err != nil {
+					t.Fatalf("POST %s: %v", path, err)
+				}
+				response.Body.Close()
+
+				isJSON := strings.HasPrefix(contentType, "application/json")
+				if got := response.StatusCode == http.StatusUnsupportedMediaType; got == isJSON {
+					t.Errorf("status = %d with Content-Type %q", response.StatusCode, contentType)
+				}
+			})
+		}
+	}
+}
+
+// MaxRequestBytes を超えるリクエストボディに，JSON のボディを受け取る各 API が 413 を返すことを確認する．
+func TestOversizedRequestBody(t *testing.T) {
+	config := newTestConfig(t)
+	config.MaxRequestBytes = 1 << 10
+	server := newTestServer(t, config)
+	client := server.newClient()
+
+	oversized := flipRequest{Name: strings.Repeat("a", int(config.MaxRequestBytes))}
+	for _, path := range []string{"/api/flip", "/api/theme", "/api/game"} {
+		t.Run(path, func(t *testing.T) {
+			response := server.do(client, http.MethodPost, path, oversized)
+			if response.StatusCode != http.StatusRequestEntityTooLarge {
+				t.Errorf("status = %d, want %d: %s", response.StatusCode, http.StatusRequestEntityTooLarge, readBody(t, response))
+			}
+		})
+	}
+
+	response := server.do(client, http.MethodPost, "/api/flip", flipRequest{Card: 0})
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("small body: status = %d, want %d", response.StatusCode, http.StatusOK)
+	}
+}
+
+// 各難易度の盤面で，Solve のめくり方どおりに POST /api/flip でめくると，組の数と同じ手数でゲームを終えられることを確認する．
+func TestSolveThroughFlipHandler(t *testing.T) {
+	for _, difficulty := range difficulties {
+		t.Run(difficulty.Name, func(t *testing.T) {
+			server := newTestServer(t, newTestConfig(t))
+			client := server.newClient()
+
+			var created newGameResponse
+			decodeBody(t, server.do(client, http.MethodPost, "/api/new?difficulty="+difficulty.Name, nil), &created)
+			var board *Board
+			server.app.sessions.lookupToken(created.Token, func(game *Game) {
+				board = game.Board
+			})
+			pairs := difficulty.Rows * difficulty.Cols / 2
+			solution := board.Solve()
+			if len(solution) != 2*pairs {
+				t.Fatalf("Solve returned %d flips, want %d", len(solution), 2*pairs)
+			}
+
+			var last flipResponse
+			for _, move := range solution {
+				response := server.do(client, http.MethodPost, "/api/flip", flipRequest{Card: move.CardIndex})
+				if response.StatusCode != http.StatusOK {
+					t.Fatalf("flip %d: status %d: %s", move.CardIndex, response.StatusCode, readBody(t, response))
+				}
+				last = flipResponse{}
+				decodeBody(t, response, &last)
+				if last.JustMatched != move.Matched {
+					t.Fatalf("flip %d: justMatched = %v, want %v", move.CardIndex, last.JustMatched, move.Matched)
+				}
+			}
+			if last.Matches != pairs || last.Score == nil || last.Score.Moves != pairs {
+				t.Errorf("matches = %d, score = %+v, want %d matches in %d moves", last.Matches, last.Score, pairs, pairs)
+			}
+		})
+	}
+}
+
+// GET /api/status が，状態が変わっていなければ If-None-Match に 304 を返し，カードをめくって Version が増えた後は新しい ETag で 200 を返すことを確認する．
+func TestStatusNotModified(t *testing.T) {
+	server := newTestServer(t, newTestConfig(t))
+	client := server.newClient()
+
+	var created newGameResponse
+	decodeBody(t, server.do(client, http.MethodPost, "/api/new", nil), &created)
+	version := func() int {
+		var version int
+		server.app.sessions.lookupToken(created.Token, func(game *Game) {
+			version = game.Version
+		})
+		return version
+	}
+
+	response := server.do(client, http.MethodGet, "/api/status", nil)
+	etag := response.Header.Get("ETag")
+	if response.StatusCode != http.StatusOK || !strings.HasPrefix(etag, `W/"`) {
+		t.Fatalf("status %d, ETag %q, want 200 with a weak ETag", response.StatusCode, etag)
+	}
+	response = server.do(client, http.MethodGet, "/api/status", nil, "If-None-Match", etag)
+	if response.StatusCode != http.StatusNotModified {
+		t.Errorf("unchanged game: status = %d, want %d", response.StatusCode, http.StatusNotModified)
+	}
+
+	before := version()
+	server.do(client, http.MethodPost, "/api/flip", flipRequest{Card: 0})
+	if after := version(); after <= before {
+		t.Errorf("Version = %d after a flip, want it to grow from %d", after, before)
+	}
+	response = server.do(client, http.MethodGet, "/api/status", nil, "If-None-Match", etag)
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("after a flip: status = %d, want %d", response.StatusCode, http.StatusOK)
+	}
+	if got := response.Header.Get("ETag"); got == etag {
+		t.Errorf("ETag %q did not change after a flip", got)
+	}
+}
+
+// BasePath の下に置いた場合に，その下のパスで API に応答し，セッションのクッキーもその下に限って送られることを確認する．
+func TestBasePath(t *testing.T) {
+	config := newTestConfig(t)
+	config.BasePath = "/pm"
+	server := newTestServer(t, config)
+	client := server.newClient()
+
+	response := server.do(client, http.MethodGet, "/pm/api/board", nil)
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("GET /pm/api/board: status %d, want %d", response.StatusCode, http.StatusOK)
+	}
+	var cookiePath string
+	for _, cookie := range response.Cookies() {
+		if cookie.Name == sessionCookieName {
+			cookiePath = cookie.Path
+		}
+	}
+	if cookiePath != "/pm/" {
+		t.Errorf("session cookie path = %q, want %q", cookiePath, "/pm/")
+	}
+
+	// 同じセッションのゲームをめくり続けられる．
+	var flipped flipResponse
+	server.do(client, http.MethodPost, "/pm/api/flip", flipRequest{Card: 0})
+	decodeBody(t, server.do(client, http.MethodPost, "/pm/api/flip", flipRequest{Card: 1}), &flipped)
+	if flipped.Moves != 1 {
+		t.Errorf("moves = %d after two flips, want 1", flipped.Moves)
+	}
+
+	response = server.do(client, http.MethodGet, "/api/board", nil)
+	if response.StatusCode != http.StatusNotFound {
+		t.Errorf("GET /api/board outside BasePath: status %d, want %d", response.StatusCode, http.StatusNotFound)
+	}
+}
+
+// MaxActiveGames 個のゲームを始めた後は，新しいセッションの POST /api/new に Retry-After ヘッダ付きの 503 を返し，既存のセッションは遊び続けられることを確認する．
+func TestMaxActiveGames(t *testing.T) {
+	config := newTestConfig(t)
+	config.MaxActiveGames = 3
+	server := newTestServer(t, config)
+
+	clients := make([]*http.Client, config.MaxActiveGames)
+	for i := range clients {
+		clients[i] = server.newClient()
+		response := server.do(clients[i], http.MethodPost, "/api/new", nil)
+		if response.StatusCode != http.StatusOK {
+			t.Fatalf("game %d: status %d, want %d", i, response.StatusCode, http.StatusOK)
+		}
+	}
+
+	response := server.do(server.newClient(), http.MethodPost, "/api/new", nil)
+	if response.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("one game too many: status %d, want %d", response.StatusCode, http.StatusServiceUnavailable)
+	}
+	want := strconv.Itoa(int(time.Duration(config.SweepInterval).Seconds()))
+	if got := response.Header.Get("Retry-After"); got != want {
+		t.Errorf("Retry-After = %q, want %q", got, want)
+	}
+
+	response = server.do(clients[0], http.MethodPost, "/api/new", nil)
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("existing session: status %d, want %d", response.StatusCode, http.StatusOK)
+	}
+}
+
+// 表になっているカードや揃ったカードをめくろうとして拒否された場合は，GET /api/status の ETag が変わらないことを確認する．
+func TestRejectedFlipKeepsETag(t *testing.T) {
+	server := newTestServer(t, newTestConfig(t))
+	client := server.newClient()
+
+	var created newGameResponse
+	decodeBody(t, server.do(client, http.MethodPost, "/api/new?pairs=2", nil), &created)
+	var solution []Move
+	server.app.sessions.lookupToken(created.Token, func(game *Game) {
+		solution = game.Board.Solve()
+	})
+
+	tests := []struct {
+		name  string
+		setup []int
+		card  int
+	}{
+		{name: "the face-up card", setup: []int{solution[0].CardIndex}, card: solution[0].CardIndex},
+		{name: "a matched card", setup: []int{solution[1].CardIndex}, card: solution[0].CardIndex},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, card := range test.setup {
+				server.do(client, http.MethodPost, "/api/flip", flipRequest{Card: card})
+			}
+			etag := server.do(client, http.MethodGet, "/api/status", nil).Header.Get("ETag")
+
+			response := server.do(client, http.MethodPost, "/api/flip", flipRequest{Card: test.card})
+			if response.StatusCode != http.StatusConflict {
+				t.Fatalf("flip %d: status %d, want %d", test.card, response.StatusCode, http.StatusConflict)
+			}
+			response = server.do(client, http.MethodGet, "/api/status", nil, "If-None-Match", etag)
+			if response.StatusCode != http.StatusNotModified {
+				t.Errorf("after a rejected flip: status %d, want %d", response.StatusCode, http.StatusNotModified)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// 盤面に並べる1枚のカード．
+//
+// ID は，カードの絵柄を表す番号．同じ絵柄の2枚のカードは同じ ID を持つ．
+// ImageURL は，カードの絵柄の画像の URL．
+// Matched は，カードが既に揃えられたかどうか．
+type Card struct {
+	ID       int    `json:"id"`
+	ImageURL string `json:"imageUrl"`
+	Matched  bool   `json:"matched"`
+}
+
+// カードを並べた盤面．
+//
+// Rows と Cols は，盤面の行数と列数．
+// Cards は，盤面に左上から行ごとに並べられた順のカードの列．
+type Board struct {
+	Rows  int    `json:"rows"`
+	Cols  int    `json:"cols"`
+	Cards []Card `json:"cards"`
+}
+
+// 絵柄の画像が盤面の組数に満たないことを表すエラー．
+var errNotEnoughImages = errors.New("not enough images")
+
+// 同じ絵柄のカードが隣り合わないよう並べ直す回数の上限．
+//
+// 1x2 の盤面のように隣り合わない並びが存在しない場合もあるため，上限に達したら最も隣り合う組の少ない並びを用いる．
+const maxSpreadAttempts = 100
+
+// 盤面の並べ方の選択肢．
+//
+// SpreadPairs は，同じ絵柄の2枚のカードが上下左右に隣り合わないよう並べるかどうか．
+type BoardOptions struct {
+	SpreadPairs bool
+}
+
+// 絵柄の画像の URL の一覧，盤面の行数と列数，乱数の生成器，並べ方の選択肢を受け取り，rows*cols 枚のカードを並べ替えた盤面を戻り値として返す．
+//
+// 絵柄は images からランダムに rows*cols/2 個選ぶ．
+// rows*cols が奇数の場合はエラーを，images が絵柄の組数に満たない場合は errNotEnoughImages を返す．
+// 並べ替えには random のみを用いるため，同じ images と同じ種の random からは常に同じ並びの盤面が作られる．
+func NewBoard(images []string, rows, cols int, random *rand.Rand, options BoardOptions) (*Board, error) {
+	if rows < 1 || cols < 1 || (rows*cols)%2 != 0 {
+		return nil, fmt.Errorf("a %dx%d grid cannot be filled with pairs", rows, cols)
+	}
+	pairs := rows * cols / 2
+	if len(images) < pairs {
+		return nil, fmt.Errorf("%w: %d pairs requested but only %d images are available", errNotEnoughImages, pairs, len(images))
+	}
+
+	// 用いる絵柄をランダムに選ぶ．
+	chosen := make([]string, len(images))
+	copy(chosen, images)
+	random.Shuffle(len(chosen), func(i, j int) {
+		chosen[i], chosen[j] = chosen[j], chosen[i]
+	})
+	chosen = chosen[:pairs]
+
+	// 各絵柄のカードを2枚ずつ用意する．
+	cards := make([]Card, 0, pairs*2)
+	for id, imageURL := range chosen {
+		card := Card{
+			ID:       id,
+			ImageURL: imageURL,
+		}
+		cards = append(cards, card, card)
+	}
+
+	// カードの並びをランダムに入れ替える．
+	shuffle := func() {
+		random.Shuffle(len(cards), func(i, j int) {
+			cards[i], cards[j] = cards[j], cards[i]
+		})
+	}
+	shuffle()
+
+	// 求められた場合は，同じ絵柄のカードが隣り合わなくなるまで並べ直す．
+	if options.SpreadPairs {
+		best := append([]Card(nil), cards...)
+		bestAdjacent := adjacentPairs(best, cols)
+		for attempt := 1; attempt < maxSpreadAttempts && bestAdjacent > 0; attempt++ {
+			shuffle()
+			if adjacent := adjacentPairs(cards, cols); adjacent < bestAdjacent {
+				copy(best, cards)
+				bestAdjacent = adjacent
+			}
+		}
+		cards = best
+	}
+
+	// 揃えられない絵柄が無いか確認する．
+	err := validatePairs(cards)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Board{Rows: rows, Cols: cols, Cards: cards}, nil
+}
+
+// 全てのカードの絵柄を覚えているものとして，揃っていない全ての組を最少の回数で揃えるめくり方を戻り値として返す．
+//
+// 組ごとに2枚を続けてめくるため，めくる回数は揃っていないカードの枚数に等しい．
+// 組は2枚目のカードの番号が小さい順に揃え，同じ盤面からは常に同じめくり方を返す．
+// 相手の見つからないカードはめくり方に含めないため，戻り値の長さが揃っていないカードの枚数より短い盤面は全ての組を揃えられない．
+// At は全て 0 とする．
+func (board *Board) Solve() []Move {
+	first := map[int]int{}
+	moves := []Move{}
+	for index, card := range board.Cards {
+		if card.Matched {
+			continue
+		}
+		partner, ok := first[card.ID]
+		if !ok {
+			first[card.ID] = index
+			continue
+		}
+		delete(first, card.ID)
+		moves = append(moves, Move{CardIndex: partner}, Move{CardIndex: index, Matched: true})
+	}
+	return moves
+}
+
+// 左上から行ごとに cols 枚ずつ並べたカードの列を受け取り，上下左右に隣り合う同じ絵柄のカードの組数を戻り値として返す．
+func adjacentPairs(cards []Card, cols int) int {
+	adjacent := 0
+	for i, card := range cards {
+		if (i+1)%cols != 0 && i+1 < len(cards) && cards[i+1].ID == card.ID {
+			adjacent++
+		}
+		if i+cols < len(cards) && cards[i+cols].ID == card.ID {
+			adjacent++
+		}
+	}
+	return adjacent
+}
+
+// カードの列を受け取り，全ての絵柄がちょうど2枚ずつあるか確認する．
+//
+// 画像の一覧に同じ画像が重複していると，同じ絵柄のカードが3枚以上並び，揃え方が一意に決まらなくなる．
+// そのような絵柄がある場合は，その画像と枚数を示すエラーを返す．
+func validatePairs(cards []Card) error {
+	counts := map[string]int{}
+	for _, card := range cards {
+		counts[card.ImageURL]++
+	}
+
+	invalid := []string{}
+	for imageURL, count := range counts {
+		if count != 2 {
+			invalid = append(invalid, fmt.Sprintf("%s (%d cards)", imageURL, count))
+		}
+	}
+	if len(invalid) > 0 {
+		sort.Strings(invalid)
+		return fmt.Errorf("images must appear exactly twice on a board: %s", strings.Join(invalid, ", "))
+	}
+
+	return nil
+}
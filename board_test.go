@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// 画像の一覧に同じ画像が重複していると，validatePairs と NewBoard が重複した画像を示すエラーを返すことを確認する．
+func TestValidatePairsRejectsDuplicatedImages(t *testing.T) {
+	tests := []struct {
+		name    string
+		cards   []Card
+		wantErr string
+	}{
+		{name: "pairs", cards: newTestBoard(0, 1, 1, 0).Cards},
+		{name: "one card", cards: newTestBoard(0, 0, 1).Cards, wantErr: "/images/01.png (1 cards)"},
+		{name: "four cards", cards: newTestBoard(0, 0, 0, 0).Cards, wantErr: "/images/00.png (4 cards)"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validatePairs(test.cards)
+			if test.wantErr == "" {
+				if err != nil {
+					t.Errorf("validatePairs: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("validatePairs error = %v, want it to mention %q", err, test.wantErr)
+			}
+		})
+	}
+
+	images := []string{"/images/00.png", "/images/00.png"}
+	_, err := NewBoard(images, 2, 2, rand.New(rand.NewSource(1)), BoardOptions{})
+	if err == nil || !strings.Contains(err.Error(), "/images/00.png (4 cards)") {
+		t.Errorf("NewBoard with a duplicated image list: error = %v", err)
+	}
+}
+
+// n 個の絵柄の画像の URL の一覧を戻り値として返す．
+func newTestImages(n int) []string {
+	images := make([]string, n)
+	for i := range images {
+		images[i] = fmt.Sprintf("/images/%02d.png", i)
+	}
+	return images
+}
+
+// 同じ画像の一覧と同じ種の乱数の生成器からは同じ並びの盤面が作られ，種が違えば並びも変わることを確認する．
+func TestNewBoardIsDeterministic(t *testing.T) {
+	images := newTestImages(20)
+	newBoard := func(seed int64) *Board {
+		t.Helper()
+		board, err := NewBoard(images, 4, 4, rand.New(rand.NewSource(seed)), BoardOptions{})
+		if err != nil {
+			t.Fatalf("NewBoard: %v", err)
+		}
+		return board
+	}
+
+	first, second := newBoard(42), newBoard(42)
+	if !slices.Equal(first.Cards, second.Cards) {
+		t.Errorf("boards with the same seed differ:\n%v\n%v", first.Cards, second.Cards)
+	}
+	if other := newBoard(43); slices.Equal(first.Cards, other.Cards) {
+		t.Errorf("boards with different seeds are identical: %v", first.Cards)
+	}
+}
+
+// adjacentPairs が，行をまたがずに上下左右に隣り合う同じ絵柄のカードの組を数えることを確認する．
+func TestAdjacentPairs(t *testing.T) {
+	tests := []struct {
+		name string
+		cols int
+		ids  []int
+		want int
+	}{
+		{name: "2x2 side by side", cols: 2, ids: []int{0, 0, 1, 1}, want: 2},
+		{name: "2x2 one above the other", cols: 2, ids: []int{0, 1, 0, 1}, want: 2},
+		{name: "2x2 diagonal", cols: 2, ids: []int{0, 1, 1, 0}, want: 0},
+		{name: "4x4 spread", cols: 4, ids: []int{0, 1, 2, 3, 4, 5, 6, 7, 0, 1, 2, 3, 4, 5, 6, 7}, want: 0},
+		{name: "4x4 across rows", cols: 4, ids: []int{0, 1, 2, 3, 3, 4, 5, 6, 7, 0, 1, 2, 4, 5, 6, 7}, want: 0},
+		{name: "4x4 adjacent", cols: 4, ids: []int{0, 0, 1, 1, 2, 3, 4, 5, 2, 3, 4, 5, 6, 6, 7, 7}, want: 8},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := adjacentPairs(newTestBoard(test.ids...).Cards, test.cols); got != test.want {
+				t.Errorf("adjacentPairs = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+// SpreadPairs を指定すると，同じ種で隣り合う組ができる 4x4 の盤面でも，隣り合う組が無くなることを確認する．
+func TestNewBoardSpreadPairs(t *testing.T) {
+	images := newTestImages(8)
+	const seed = 1
+	plain, err := NewBoard(images, 4, 4, rand.New(rand.NewSource(seed)), BoardOptions{})
+	if err != nil {
+		t.Fatalf("NewBoard: %v", err)
+	}
+	if adjacentPairs(plain.Cards, 4) == 0 {
+		t.Fatalf("the board without SpreadPairs has no adjacent pairs; choose another seed")
+	}
+
+	spread, err := NewBoard(images, 4, 4, rand.New(rand.NewSource(seed)), BoardOptions{SpreadPairs: true})
+	if err != nil {
+		t.Fatalf("NewBoard: %v", err)
+	}
+	if got := adjacentPairs(spread.Cards, 4); got != 0 {
+		t.Errorf("adjacentPairs = %d with SpreadPairs, want 0: %v", got, spread.Cards)
+	}
+}
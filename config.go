@@ -0,0 +1,338 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 設定ファイル中で "10s" のような文字列として記述される時間．
+type Duration time.Duration
+
+// "10s" や "1m30s" のような文字列を受け取り，時間として解釈して格納する．
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var text string
+	err := json.Unmarshal(data, &text)
+	if err != nil {
+		return fmt.Errorf("duration must be a string such as \"10s\": %w", err)
+	}
+
+	parsed, err := time.ParseDuration(text)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+
+	return nil
+}
+
+// YAML の設定ファイル中の "10s" や "1m30s" のような文字列を受け取り，時間として解釈して格納する．
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	var text string
+	err := value.Decode(&text)
+	if err != nil {
+		return fmt.Errorf("duration must be a string such as \"10s\": %w", err)
+	}
+
+	parsed, err := time.ParseDuration(text)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+
+	return nil
+}
+
+// 時間を "10s" のような文字列として出力する．
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// プログラム実行時の設定をまとめた構造体．
+//
+// JSON と YAML のどちらの設定ファイルからも同じ名前で読み出せるよう，各項目には両方のタグを付ける．
+//
+// Host は，サーバーのIPアドレス．
+// Address は，サーバーが受け付ける "ホスト:ポート" 形式のアドレス．省略した場合は Host と環境変数 PORT から決める．
+// ShutdownTimeout は，終了シグナル受信後に処理中のリクエストの完了を待つ時間．
+// ReadTimeout は，リクエスト全体の読み込みに許す時間．
+// WriteTimeout は，レスポンスの書き込みに許す時間．
+// IdleTimeout は，keep-alive 中の接続が次のリクエストを待つ時間．
+// ScoresFile は，リーダーボードの成績を保存するファイルのパス．
+// ScoreBackend は，成績の保存形式．"file" の場合は JSON ファイルに，"sqlite" の場合は SQLite のデータベースに保存する．
+// LogFormat は，リクエストログの形式．"text" か "json" を指定する．
+// LogLevel は，出力するログの重要度の下限．"debug"，"info"，"error" のいずれかを指定する．
+// LogFile は，ログを追記するファイルのパス．省略した場合は標準エラー出力に出力する．
+// TLSCertFile と TLSKeyFile は，HTTPS で配信する際の証明書と秘密鍵のファイルのパス．
+// RedirectHTTP は，HTTPS で配信する際に，ポート 80 への HTTP のリクエストを HTTPS に転送するかどうか．
+// EnableH2C は，証明書を用いずに HTTP/2 (h2c) でも配信するかどうか．手元での開発用であり，h2c に対応しないプロキシの下では使えない．HTTPS とは併用できない．
+// BasePath は，リバースプロキシの下で "/pm" のようなパスに置く場合のパスの接頭辞．省略した場合はルートに置く．
+// StaticDir は，/game/ で配信する CSS や JavaScript などの静的なファイルを置くディレクトリ．
+// TemplateDir は，ページのテンプレートファイルを置くディレクトリ．
+// ImageDir は，カードの絵柄の画像を置くディレクトリ．サブディレクトリはそれぞれ1つのテーマとして扱う．既定のテーマを表す "default" という名前のサブディレクトリは置けない．
+// ResultFontFile は，共有用の成績の画像に用いる TrueType か OpenType のフォントファイルのパス．省略した場合や読み出せない場合は，英数字のみを書ける組み込みのフォントを用いる．
+// SessionIdleTimeout は，参照されないセッションを削除するまでの時間．
+// SweepInterval は，参照されないセッションを探す間隔．
+// StaticMaxAge は，ブラウザが静的なファイルをキャッシュしてよい時間．
+// MaxHints は，1回のゲームで使えるヒントの回数．
+// FlipsPerSecond は，1つのセッションでカードをめくれる1秒あたりの回数．0 の場合は制限しない．
+// MismatchResetMillis は，揃わなかった2枚のカードを自動で裏に戻すまでのミリ秒数．0 の場合は次にカードをめくるまで表のままとする．
+// MaxActiveGames は，同時に遊べるゲームの数の上限．セッションごとに1つのゲームを数え，超えた場合は 503 を返す．対戦の部屋の数も別に同じ数までに制限する．0 の場合は制限しない．
+// MaxRequestBytes は，リクエストボディと対戦の部屋に送る WebSocket のメッセージの大きさの上限のバイト数．リクエストボディが超えた場合は 413 を返す．
+// AllowedOrigins は，JSON API へのリクエストを許可する別の送信元の一覧．"*" を含めると全ての送信元を許可する．
+// AdminToken は，POST /admin/reload などの管理用のエンドポイントに必要なトークン．省略した場合は管理用のエンドポイントを使えない．
+type Configuration struct {
+	Host            string   `json:"Host" yaml:"Host"`
+	Address         string   `json:"Address" yaml:"Address"`
+	ShutdownTimeout Duration `json:"ShutdownTimeout" yaml:"ShutdownTimeout"`
+	ReadTimeout     Duration `json:"ReadTimeout" yaml:"ReadTimeout"`
+	WriteTimeout    Duration `json:"WriteTimeout" yaml:"WriteTimeout"`
+	IdleTimeout     Duration `json:"IdleTimeout" yaml:"IdleTimeout"`
+	ScoresFile      string   `json:"ScoresFile" yaml:"ScoresFile"`
+	ScoreBackend    string   `json:"ScoreBackend" yaml:"ScoreBackend"`
+	LogFormat       string   `json:"LogFormat" yaml:"LogFormat"`
+	LogLevel        string   `json:"LogLevel" yaml:"LogLevel"`
+	LogFile         string   `json:"LogFile" yaml:"LogFile"`
+	TLSCertFile     string   `json:"TLSCertFile" yaml:"TLSCertFile"`
+	TLSKeyFile      string   `json:"TLSKeyFile" yaml:"TLSKeyFile"`
+	RedirectHTTP    bool     `json:"RedirectHTTP" yaml:"RedirectHTTP"`
+	EnableH2C       bool     `json:"EnableH2C" yaml:"EnableH2C"`
+	BasePath        string   `json:"BasePath" yaml:"BasePath"`
+	StaticDir       string   `json:"StaticDir" yaml:"StaticDir"`
+	TemplateDir     string   `json:"TemplateDir" yaml:"TemplateDir"`
+	ImageDir        string   `json:"ImageDir" yaml:"ImageDir"`
+	ResultFontFile  string   `json:"ResultFontFile" yaml:"ResultFontFile"`
+
+	SessionIdleTimeout Duration `json:"SessionIdleTimeout" yaml:"SessionIdleTimeout"`
+	SweepInterval      Duration `json:"SweepInterval" yaml:"SweepInterval"`
+
+	StaticMaxAge Duration `json:"StaticMaxAge" yaml:"StaticMaxAge"`
+
+	MaxHints       int     `json:"MaxHints" yaml:"MaxHints"`
+	FlipsPerSecond float64 `json:"FlipsPerSecond" yaml:"FlipsPerSecond"`
+
+	MismatchResetMillis int `json:"MismatchResetMillis" yaml:"MismatchResetMillis"`
+
+	MaxActiveGames  int   `json:"MaxActiveGames" yaml:"MaxActiveGames"`
+	MaxRequestBytes int64 `json:"MaxRequestBytes" yaml:"MaxRequestBytes"`
+
+	AllowedOrigins []string `json:"AllowedOrigins" yaml:"AllowedOrigins"`
+
+	AdminToken string `json:"AdminToken" yaml:"AdminToken"`
+}
+
+// 設定ファイルに省略された項目に用いる既定値の設定を戻り値として返す．
+//
+// Address の既定値は環境変数 PORT によって変わるため，ここでは空のままとし，loadConfig で補う．
+func DefaultConfiguration() *Configuration {
+	return &Configuration{
+		ShutdownTimeout: Duration(10 * time.Second),
+		ReadTimeout:     Duration(15 * time.Second),
+		WriteTimeout:    Duration(15 * time.Second),
+		IdleTimeout:     Duration(60 * time.Second),
+		ScoresFile:      "scores.json",
+		ScoreBackend:    scoreBackendFile,
+		LogFormat:       logFormatText,
+		LogLevel:        "info",
+		StaticDir:       "game",
+		TemplateDir:     "game",
+		ImageDir:        "images",
+
+		SessionIdleTimeout: Duration(30 * time.Minute),
+		SweepInterval:      Duration(time.Minute),
+
+		StaticMaxAge: Duration(time.Hour),
+
+		MaxHints:       3,
+		FlipsPerSecond: 5,
+
+		MaxRequestBytes: 64 << 10,
+	}
+}
+
+// サーバー上のパスを受け取り，BasePath を前に付けたクライアントから見える URL のパスを戻り値として返す．
+func (config *Configuration) urlFor(path string) string {
+	return config.BasePath + path
+}
+
+// 揃わなかった2枚のカードを自動で裏に戻すまでの時間を戻り値として返す．自動で戻さない場合は 0 を返す．
+func (config *Configuration) mismatchResetDelay() time.Duration {
+	return time.Duration(config.MismatchResetMillis) * time.Millisecond
+}
+
+// 設定を出力する際に，秘密にすべき値の代わりに書き出す文字列．
+const redactedValue = "[redacted]"
+
+// AdminToken などの秘密にすべき値を伏せた設定の複製を戻り値として返す．設定を出力する際に用いる．
+func (config *Configuration) redacted() *Configuration {
+	copied := *config
+	if copied.AdminToken != "" {
+		copied.AdminToken = redactedValue
+	}
+	return &copied
+}
+
+// HTTPS で配信するよう設定されているかどうかを戻り値として返す．
+func (config *Configuration) TLSEnabled() bool {
+	return config.TLSCertFile != "" && config.TLSKeyFile != ""
+}
+
+// Address が省略され，環境変数 PORT も無い場合に用いるポート．
+const defaultPort = "8080"
+
+// 設定ファイルのパスを指定する環境変数の名前．
+const configPathEnv = "PICMATCH_CONFIG"
+
+// 設定ファイルのパスが指定されなかった場合に用いるパス．
+const defaultConfigPath = "config.json"
+
+// コマンドライン引数 -config の値を受け取り，読み出す設定ファイルのパスを戻り値として返す．
+//
+// パスは以下の順に決定する．
+//  1. -config フラグの値
+//  2. 環境変数 PICMATCH_CONFIG の値
+//  3. 作業ディレクトリの config.json
+func resolveConfigPath(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	if envValue := os.Getenv(configPathEnv); envValue != "" {
+		return envValue
+	}
+	return defaultConfigPath
+}
+
+// path にある設定ファイルからプログラム実行時の設定を読み出し，構造体に格納して戻り値として返す．
+//
+// 拡張子が .json のファイルは JSON として，.yaml または .yml のファイルは YAML として読み出す．それ以外の拡張子はエラーとする．
+// 成功時は構造体のアドレスを返し，失敗時は nil とエラーを返す．
+func loadConfig(path string) (*Configuration, error) {
+	// 拡張子から設定ファイルの形式を決める．
+	var decode func(file *os.File, config *Configuration) error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		decode = func(file *os.File, config *Configuration) error {
+			return json.NewDecoder(file).Decode(config)
+		}
+	case ".yaml", ".yml":
+		decode = func(file *os.File, config *Configuration) error {
+			return yaml.NewDecoder(file).Decode(config)
+		}
+	default:
+		return nil, fmt.Errorf("config file %q must have a .json, .yaml or .yml extension", path)
+	}
+
+	// 設定ファイルを読み出す．
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open config file %q: %w", path, err)
+	}
+	defer file.Close()
+
+	// 読み出した設定データを既定値の上に重ねて格納し，省略された項目には既定値を残す．
+	config := DefaultConfiguration()
+	err = decode(file, config)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode config file %q: %w", path, err)
+	}
+
+	// 省略されたアドレスを補う．
+	if config.Address == "" {
+		port := os.Getenv("PORT")
+		if port == "" {
+			port = defaultPort
+		}
+		config.Address = config.Host + ":" + port
+		logInfo("Address is not set, defaulting to", config.Address)
+	}
+
+	// "/pm/" のように書かれた BasePath の末尾のスラッシュを除く．
+	config.BasePath = strings.TrimSuffix(config.BasePath, "/")
+
+	// 設定値が妥当であるか検証する．
+	err = config.validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid config file %q: %w", path, err)
+	}
+
+	return config, nil
+}
+
+// 設定値が妥当であるか検証し，妥当でなければその理由を表すエラーを返す．
+func (config *Configuration) validate() error {
+	_, _, err := net.SplitHostPort(config.Address)
+	if err != nil {
+		return fmt.Errorf("Address %q must be in the form \"host:port\": %w", config.Address, err)
+	}
+
+	durations := []struct {
+		name  string
+		value Duration
+	}{
+		{"ShutdownTimeout", config.ShutdownTimeout},
+		{"ReadTimeout", config.ReadTimeout},
+		{"WriteTimeout", config.WriteTimeout},
+		{"IdleTimeout", config.IdleTimeout},
+		{"SessionIdleTimeout", config.SessionIdleTimeout},
+		{"SweepInterval", config.SweepInterval},
+		{"StaticMaxAge", config.StaticMaxAge},
+	}
+	for _, duration := range durations {
+		if duration.value < 0 {
+			return fmt.Errorf("%s must not be negative, got %s", duration.name, time.Duration(duration.value))
+		}
+	}
+	if config.MaxHints < 0 {
+		return fmt.Errorf("MaxHints must not be negative, got %d", config.MaxHints)
+	}
+	if config.FlipsPerSecond < 0 {
+		return fmt.Errorf("FlipsPerSecond must not be negative, got %g", config.FlipsPerSecond)
+	}
+	if config.MismatchResetMillis < 0 {
+		return fmt.Errorf("MismatchResetMillis must not be negative, got %d", config.MismatchResetMillis)
+	}
+	if config.MaxActiveGames < 0 {
+		return fmt.Errorf("MaxActiveGames must not be negative, got %d", config.MaxActiveGames)
+	}
+	if config.MaxRequestBytes <= 0 {
+		return fmt.Errorf("MaxRequestBytes must be positive, got %d", config.MaxRequestBytes)
+	}
+	if config.SessionIdleTimeout == 0 || config.SweepInterval == 0 {
+		return fmt.Errorf("SessionIdleTimeout and SweepInterval must be positive")
+	}
+
+	if config.LogFormat != logFormatText && config.LogFormat != logFormatJSON {
+		return fmt.Errorf("LogFormat must be %q or %q, got %q", logFormatText, logFormatJSON, config.LogFormat)
+	}
+	if config.ScoreBackend != scoreBackendFile && config.ScoreBackend != scoreBackendSQLite {
+		return fmt.Errorf("ScoreBackend must be %q or %q, got %q", scoreBackendFile, scoreBackendSQLite, config.ScoreBackend)
+	}
+	if _, ok := logLevels[config.LogLevel]; !ok {
+		return fmt.Errorf("LogLevel must be one of %s, got %q", logLevelNames(), config.LogLevel)
+	}
+
+	if config.BasePath != "" && (!strings.HasPrefix(config.BasePath, "/") || path.Clean(config.BasePath) != config.BasePath) {
+		return fmt.Errorf("BasePath must be a clean path starting with \"/\" such as \"/pm\", got %q", config.BasePath)
+	}
+
+	// スプライトの URL では "default" が既定のテーマを表すため，同じ名前のテーマは使えない．
+	if info, err := os.Stat(filepath.Join(config.ImageDir, defaultThemePathName)); err == nil && info.IsDir() {
+		return fmt.Errorf("ImageDir must not contain a theme named %q, the name is reserved for the default theme", defaultThemePathName)
+	}
+
+	if (config.TLSCertFile == "") != (config.TLSKeyFile == "") {
+		return fmt.Errorf("TLSCertFile and TLSKeyFile must be set together")
+	}
+	if config.EnableH2C && config.TLSEnabled() {
+		return fmt.Errorf("EnableH2C cannot be used with TLSCertFile and TLSKeyFile, HTTPS already serves HTTP/2")
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 設定を出力する際に，AdminToken が伏せられ，元の設定は変わらないことを確認する．
+func TestConfigurationRedacted(t *testing.T) {
+	tests := []struct {
+		token string
+		want  string
+	}{
+		{token: "", want: ""},
+		{token: "secret", want: redactedValue},
+	}
+	for _, test := range tests {
+		config := DefaultConfiguration()
+		config.AdminToken = test.token
+		if got := config.redacted().AdminToken; got != test.want {
+			t.Errorf("redacted AdminToken for %q = %q, want %q", test.token, got, test.want)
+		}
+		if config.AdminToken != test.token {
+			t.Errorf("AdminToken changed to %q", config.AdminToken)
+		}
+	}
+}
+
+// ImageDir に既定のテーマの別名と同じ名前のテーマがある場合は，設定の検証で拒否することを確認する．
+func TestValidateRejectsReservedThemeName(t *testing.T) {
+	for _, reserved := range []bool{false, true} {
+		config := DefaultConfiguration()
+		config.Address = "localhost:8080"
+		config.ImageDir = newTestImageDir(t, map[string]int{"": defaultPairs, "animals": defaultPairs})
+		if reserved {
+			err := os.Mkdir(filepath.Join(config.ImageDir, defaultThemePathName), 0o755)
+			if err != nil {
+				t.Fatalf("Mkdir: %v", err)
+			}
+		}
+		err := config.validate()
+		if reserved != (err != nil && strings.Contains(err.Error(), defaultThemePathName)) {
+			t.Errorf("theme %q present = %v: validate error = %v", defaultThemePathName, reserved, err)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// 全ての送信元を許可することを表す AllowedOrigins の要素．
+const corsAnyOrigin = "*"
+
+// 事前確認のリクエストに対して許可するメソッドとヘッダ．
+const (
+	corsAllowMethods = "GET, POST, OPTIONS"
+	corsAllowHeaders = "Content-Type, " + requestIDHeader
+)
+
+// 別の送信元のページのスクリプトにも読ませるレスポンスのヘッダ．
+const corsExposeHeaders = requestIDHeader
+
+// 別の送信元から配信されたページによる，apiPathPrefix 以下の JSON API へのリクエストを，allowedOrigins に含まれる送信元に限り許可するミドルウェア．
+//
+// 送信元が明示的に列挙されている場合は Cookie を伴うリクエストも許可する．
+// "*" による許可は Cookie を伴わないリクエストに限る．
+// 許可したリクエストのレスポンスでは，リクエスト ID のヘッダをスクリプトから読めるようにする．
+// OPTIONS による事前確認のリクエストには，後続のハンドラを呼ばずに応答する．
+func corsMiddleware(next http.Handler, allowedOrigins []string) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		origin := request.Header.Get("Origin")
+		if origin == "" || !strings.HasPrefix(request.URL.Path, apiPathPrefix) {
+			next.ServeHTTP(writer, request)
+			return
+		}
+
+		header := writer.Header()
+		header.Add("Vary", "Origin")
+		switch {
+		case slices.Contains(allowedOrigins, origin):
+			header.Set("Access-Control-Allow-Origin", origin)
+			header.Set("Access-Control-Allow-Credentials", "true")
+		case slices.Contains(allowedOrigins, corsAnyOrigin):
+			header.Set("Access-Control-Allow-Origin", corsAnyOrigin)
+		}
+		if header.Get("Access-Control-Allow-Origin") != "" {
+			header.Set("Access-Control-Expose-Headers", corsExposeHeaders)
+		}
+
+		// 事前確認のリクエストには，許可するメソッドとヘッダを返して終える．
+		if request.Method == http.MethodOptions && request.Header.Get("Access-Control-Request-Method") != "" {
+			if header.Get("Access-Control-Allow-Origin") != "" {
+				header.Set("Access-Control-Allow-Methods", corsAllowMethods)
+				header.Set("Access-Control-Allow-Headers", corsAllowHeaders)
+			}
+			writer.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(writer, request)
+	})
+}
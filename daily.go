@@ -0,0 +1,216 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 日替わりの盤面の日付の書式．
+const dailyDateLayout = "2006-01-02"
+
+// 日付を受け取り，その日の日替わりの盤面の並べ替えに用いる乱数の種を戻り値として返す．
+//
+// 種は UTC の日付のみから決まるため，同じ日には全てのプレイヤーが同じ盤面で遊び，過ぎた日の盤面も作り直せる．
+func dailySeed(date time.Time) int64 {
+	hash := fnv.New64a()
+	hash.Write([]byte("picmatch-daily-" + date.UTC().Format(dailyDateLayout)))
+	return int64(hash.Sum64())
+}
+
+// 日付を受け取り，その日の日替わりの盤面で始めるゲームを戻り値として返す．
+//
+// 盤面は既定のテーマの画像を既定の組数だけ並べる．画像の一覧が同じであれば，同じ日付からは常に同じ盤面が作られる．
+func (app *application) startDailyGame(date time.Time) (*Game, error) {
+	rows, cols := gridForPairs(defaultPairs)
+	random := rand.New(rand.NewSource(dailySeed(date)))
+	board, err := NewBoard(app.currentThemes()[defaultTheme], rows, cols, random, BoardOptions{})
+	if err != nil {
+		return nil, err
+	}
+	game, err := NewGame(board)
+	if err != nil {
+		return nil, err
+	}
+	game.Theme = defaultTheme
+	game.DailyDate = date.UTC().Format(dailyDateLayout)
+	game.setMismatchReset(app.config.mismatchResetDelay())
+	app.metrics.gamesStarted.Add(1)
+	return game, nil
+}
+
+// 日替わりの盤面の成績を，日付ごとに通常のリーダーボードとは別の保存先に記録する構造体．
+//
+// 保存先は ScoresFile の拡張子の前に ".daily-日付" を付けたパスとし，直近に使った日付の保存先のみを開いておく．
+// 複数のリクエストから同時に使われるため，全ての操作は mutex で直列化する．
+type dailyScores struct {
+	mutex   sync.Mutex
+	backend string
+	path    string
+	date    string
+	store   ScoreStore
+}
+
+func newDailyScores(backend string, path string) *dailyScores {
+	return &dailyScores{backend: backend, path: path}
+}
+
+// 日付を受け取り，その日の成績を保存するファイルのパスを戻り値として返す．
+func (daily *dailyScores) pathFor(date string) string {
+	extension := filepath.Ext(daily.path)
+	return strings.TrimSuffix(daily.path, extension) + ".daily-" + date + extension
+}
+
+// 日付を受け取り，その日の成績の保存先を戻り値として返す．呼び出し側で mutex を獲得しておくこと．
+//
+// 別の日付の保存先を開いている場合は，それを閉じてから開く．
+func (daily *dailyScores) open(date string) (ScoreStore, error) {
+	if daily.store != nil && daily.date == date {
+		return daily.store, nil
+	}
+	store, err := openScoreStore(daily.backend, daily.pathFor(date))
+	if err != nil {
+		return nil, err
+	}
+	if daily.store != nil {
+		daily.store.Close()
+	}
+	daily.date = date
+	daily.store = store
+	return store, nil
+}
+
+// 日付，プレイヤーの名前，成績を受け取り，その日の成績として保存する．
+func (daily *dailyScores) Add(date string, name string, score Score) error {
+	daily.mutex.Lock()
+	defer daily.mutex.Unlock()
+
+	store, err := daily.open(date)
+	if err != nil {
+		return err
+	}
+	return store.Add(name, score)
+}
+
+// 日付を受け取り，その日の成績を得点の高い順に最大 n 件戻り値として返す．
+//
+// 任意の日付を問い合わせてファイルを作らせることのできないよう，その日の成績の保存先がまだ無い場合は，開かずに空の一覧を返す．
+func (daily *dailyScores) Top(date string, n int) ([]LeaderboardEntry, error) {
+	daily.mutex.Lock()
+	defer daily.mutex.Unlock()
+
+	if daily.store == nil || daily.date != date {
+		_, err := os.Stat(daily.pathFor(date))
+		if errors.Is(err, fs.ErrNotExist) {
+			return []LeaderboardEntry{}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	store, err := daily.open(date)
+	if err != nil {
+		return nil, err
+	}
+	return store.Top(n)
+}
+
+// 開いている保存先を閉じる．
+func (daily *dailyScores) Close() error {
+	daily.mutex.Lock()
+	defer daily.mutex.Unlock()
+
+	if daily.store == nil {
+		return nil
+	}
+	err := daily.store.Close()
+	daily.store = nil
+	return err
+}
+
+// POST /api/daily のレスポンスの形式．
+//
+// Date は，日替わりの盤面の日付．
+type dailyResponse struct {
+	Date  string `json:"date"`
+	Token string `json:"token"`
+	Rows  int    `json:"rows"`
+	Cols  int    `json:"cols"`
+	Cards int    `json:"cards"`
+}
+
+// POST /api/daily を処理し，セッションのゲームを今日の日替わりの盤面のゲームにする．
+//
+// 遊んでいるゲームを置き換えるため，GET では受け付けない．
+// 今日の日付は UTC で決める．セッションのゲームが既に今日の日替わりの盤面で，まだ終えていなければ，そのまま続ける．
+// 日替わりの盤面で終えたゲームの成績は，通常のリーダーボードではなく，その日のリーダーボードに記録する．
+// 同じ日の盤面は何度でも遊べるが，記録するのはセッションごとに最初に終えたゲームの成績のみとする．
+func (app *application) dailyHandler(writer http.ResponseWriter, request *http.Request) {
+	if !requireMethod(writer, request, http.MethodPost) {
+		return
+	}
+
+	id := sessionIDFromContext(request.Context())
+	now := time.Now()
+	today := now.UTC().Format(dailyDateLayout)
+
+	game, err := app.sessions.replace(id, func(current *Game) (*Game, error) {
+		if current != nil && current.DailyDate == today && !current.IsComplete() && !current.Failed {
+			return current, nil
+		}
+		return app.startDailyGame(now)
+	})
+	if errors.Is(err, errTooManyGames) {
+		app.writeTooManyGames(writer)
+		return
+	}
+	if err != nil {
+		logRequestError(request, "Cannot start daily game", err)
+		writeError(writer, http.StatusInternalServerError, "cannot start daily game")
+		return
+	}
+
+	writeJSON(writer, http.StatusOK, dailyResponse{
+		Date:  game.DailyDate,
+		Token: game.Token,
+		Rows:  game.Board.Rows,
+		Cols:  game.Board.Cols,
+		Cards: len(game.Board.Cards),
+	})
+}
+
+// GET /api/daily/leaderboard を処理し，日替わりの盤面の成績を得点の高い順に JSON として返す．
+//
+// クエリパラメータ date に "2006-01-02" の形式で日付を指定すると，その日の成績を返す．省略した場合は UTC の今日の成績を返す．
+// まだ成績の無い日付には空の一覧を返す．
+func (app *application) dailyLeaderboardHandler(writer http.ResponseWriter, request *http.Request) {
+	if !requireMethod(writer, request, http.MethodGet) {
+		return
+	}
+
+	date := request.URL.Query().Get("date")
+	if date == "" {
+		date = time.Now().UTC().Format(dailyDateLayout)
+	}
+	_, err := time.Parse(dailyDateLayout, date)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, fmt.Sprintf("date must be in the form %q", dailyDateLayout))
+		return
+	}
+
+	top, err := app.dailyScores.Top(date, leaderboardTopCount)
+	if err != nil {
+		logRequestError(request, "Cannot read daily scores", err)
+		writeError(writer, http.StatusInternalServerError, "cannot read scores")
+		return
+	}
+	writeJSON(writer, http.StatusOK, top)
+}
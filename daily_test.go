@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"slices"
+	"testing"
+	"time"
+)
+
+// dailySeed が UTC の日付のみから決まり，過ぎた日の盤面も同じ種から作り直せることを確認する．
+func TestDailySeed(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*60*60)
+	morning := time.Date(2026, 10, 14, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		other time.Time
+		same  bool
+	}{
+		{name: "later the same day", other: morning.Add(23*time.Hour + 59*time.Minute), same: true},
+		{name: "same instant in another zone", other: morning.In(tokyo), same: true},
+		{name: "same local date but previous UTC date", other: time.Date(2026, 10, 14, 8, 0, 0, 0, tokyo), same: false},
+		{name: "next day", other: morning.AddDate(0, 0, 1), same: false},
+		{name: "a year earlier", other: morning.AddDate(-1, 0, 0), same: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := dailySeed(morning) == dailySeed(test.other); got != test.same {
+				t.Errorf("seeds equal = %v for %v and %v, want %v", got, morning, test.other, test.same)
+			}
+		})
+	}
+
+	// 同じ日付からは，何度作っても同じ盤面になる．
+	server := newTestServer(t, newTestConfig(t))
+	yesterday := time.Now().AddDate(0, 0, -1)
+	first, err := server.app.startDailyGame(yesterday)
+	if err != nil {
+		t.Fatalf("startDailyGame: %v", err)
+	}
+	second, err := server.app.startDailyGame(yesterday)
+	if err != nil {
+		t.Fatalf("startDailyGame: %v", err)
+	}
+	if !slices.Equal(first.Board.Cards, second.Board.Cards) {
+		t.Error("boards for the same date differ")
+	}
+}
+
+// 日替わりの盤面を同じセッションで繰り返し終えても，その日のリーダーボードには最初の成績のみを記録することを確認する．
+func TestDailyRecordsFirstCompletionOnly(t *testing.T) {
+	server := newTestServer(t, newTestConfig(t))
+	client := server.newClient()
+
+	for round := range 2 {
+		var daily dailyResponse
+		decodeBody(t, server.do(client, http.MethodPost, "/api/daily", nil), &daily)
+		var board *Board
+		server.app.sessions.lookupToken(daily.Token, func(game *Game) {
+			board = game.Board
+		})
+		for _, move := range board.Solve() {
+			response := server.do(client, http.MethodPost, "/api/flip", flipRequest{Card: move.CardIndex, Name: "tester"})
+			if response.StatusCode != http.StatusOK {
+				t.Fatalf("round %d: flip %d: status %d", round, move.CardIndex, response.StatusCode)
+			}
+		}
+	}
+
+	var entries []LeaderboardEntry
+	decodeBody(t, server.do(client, http.MethodGet, "/api/daily/leaderboard", nil), &entries)
+	if len(entries) != 1 {
+		t.Errorf("daily leaderboard has %d entries, want 1", len(entries))
+	}
+	decodeBody(t, server.do(client, http.MethodGet, "/api/leaderboard", nil), &entries)
+	if len(entries) != 0 {
+		t.Errorf("general leaderboard has %d entries, want none", len(entries))
+	}
+}
+
+// 遊んでいるゲームが GET /api/daily で日替わりの盤面に置き換えられないことを確認する．
+func TestDailyRequiresPost(t *testing.T) {
+	server := newTestServer(t, newTestConfig(t))
+	client := server.newClient()
+
+	var created newGameResponse
+	decodeBody(t, server.do(client, http.MethodPost, "/api/new", nil), &created)
+	response := server.do(client, http.MethodGet, "/api/daily", nil)
+	if response.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET /api/daily: status %d, want %d", response.StatusCode, http.StatusMethodNotAllowed)
+	}
+	if !server.app.sessions.lookupToken(created.Token, func(*Game) {}) {
+		t.Error("GET /api/daily replaced the game in progress")
+	}
+}
+
+// 成績の無い日付を問い合わせても，空の一覧を返すのみで成績のファイルを作らないことを確認する．
+func TestDailyLeaderboardDoesNotCreateFiles(t *testing.T) {
+	config := newTestConfig(t)
+	server := newTestServer(t, config)
+	client := server.newClient()
+
+	for _, date := range []string{"1999-01-01", "2999-12-31", time.Now().UTC().Format(dailyDateLayout)} {
+		response := server.do(client, http.MethodGet, "/api/daily/leaderboard?date="+date, nil)
+		var entries []LeaderboardEntry
+		decodeBody(t, response, &entries)
+		if response.StatusCode != http.StatusOK || entries == nil || len(entries) != 0 {
+			t.Errorf("date %s: status %d, entries %v, want an empty list", date, response.StatusCode, entries)
+		}
+		_, err := os.Stat(server.app.dailyScores.pathFor(date))
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("date %s: scores file exists (%v), want none", date, err)
+		}
+	}
+}
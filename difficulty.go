@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 難易度と，それに対応する盤面の行数と列数．
+type Difficulty struct {
+	Name string `json:"name"`
+	Rows int    `json:"rows"`
+	Cols int    `json:"cols"`
+}
+
+// 選べる難易度の一覧．易しい順に並べる．
+var difficulties = []Difficulty{
+	{Name: "easy", Rows: 3, Cols: 4},
+	{Name: "medium", Rows: 4, Cols: 4},
+	{Name: "hard", Rows: 6, Cols: 6},
+}
+
+// 難易度の名前を受け取り，対応する盤面の行数と列数を戻り値として返す．
+//
+// 存在しない名前には，選べる名前の一覧を含むエラーを返す．
+func gridForDifficulty(name string) (rows, cols int, err error) {
+	names := make([]string, len(difficulties))
+	for i, difficulty := range difficulties {
+		if difficulty.Name == name {
+			return difficulty.Rows, difficulty.Cols, nil
+		}
+		names[i] = difficulty.Name
+	}
+	return 0, 0, fmt.Errorf("unknown difficulty %q (accepted: %s)", name, strings.Join(names, ", "))
+}
+
+// 盤面の行数と列数を受け取り，それに対応する難易度の名前を戻り値として返す．
+//
+// どの難易度にも当てはまらない大きさの場合は，false を返す．
+func difficultyForGrid(rows, cols int) (string, bool) {
+	for _, difficulty := range difficulties {
+		if difficulty.Rows == rows && difficulty.Cols == cols {
+			return difficulty.Name, true
+		}
+	}
+	return "", false
+}
+
+// 絵柄の組数を受け取り，pairs*2 枚のカードをなるべく正方形に近く並べる行数と列数を戻り値として返す．
+func gridForPairs(pairs int) (rows, cols int) {
+	cards := pairs * 2
+	rows = 1
+	for candidate := 1; candidate*candidate <= cards; candidate++ {
+		if cards%candidate == 0 {
+			rows = candidate
+		}
+	}
+	return rows, cards / rows
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// Flip に渡されたカードの番号が盤面の範囲外であることを表すエラー．
+var errCardOutOfRange = errors.New("card index is out of range")
+
+// Flip に渡されたカードが既に揃っているか表になっていることを表すエラー．
+var errCardUnavailable = errors.New("card is already matched or face up")
+
+// ヒントの使用回数が上限に達していることを表すエラー．
+var errNoHintsLeft = errors.New("no hints left for this game")
+
+// 揃えていない組が無く，ヒントを出せないことを表すエラー．
+var errNothingToHint = errors.New("all pairs are already matched")
+
+// 制限時間のあるゲームで，時間切れになった後にカードをめくろうとしたことを表すエラー．
+var errTimeUp = errors.New("time is up for this game")
+
+// 全てのカードの絵柄を見せている間にめくろうとしたことを表すエラー．
+var errRevealing = errors.New("cards cannot be flipped while they are being revealed")
+
+// 1回のゲームで記録するめくり方の最大数．これを超えためくり方は記録しない．
+//
+// 揃えずにめくり続けるプレイヤーのために，記録が際限なく大きくならないようにする．
+const maxReplayMoves = 2000
+
+// 1回カードをめくった記録．
+//
+// CardIndex は，めくったカードの番号．
+// At は，ゲームを始めてからめくるまでの時間．
+// Matched は，それにより絵柄の組が揃ったかどうか．
+type Move struct {
+	CardIndex int
+	At        time.Duration
+	Matched   bool
+}
+
+// 1人のプレイヤーが遊んでいるゲームの状態．
+//
+// Token は，ゲームごとに発行される識別子．
+// Board は，ゲームに用いる盤面．
+// Theme は，盤面の絵柄に用いたテーマの名前．
+// FaceUp は，現在表になっている揃っていないカードの番号の列．
+// Moves は，2枚のカードをめくった回数．
+// Matches は，揃えた絵柄の組数．
+// HintsUsed は，ヒントを使った回数．
+// StartedAt は，ゲームを始めた時刻．
+// FinishedAt は，全ての組を揃えた時刻．ゲームが終わっていなければゼロ値．
+// Deadline は，制限時間のあるゲームで全ての組を揃えなければならない時刻．制限時間が無ければゼロ値．
+// Failed は，制限時間内に全ての組を揃えられなかったかどうか．
+// Replay は，めくった順のカードの記録．maxReplayMoves 件までを記録する．
+// ReplayTruncated は，Replay に記録していないめくりがあるかどうか．上限を超えた場合や，保存された状態から再開した場合に true とする．
+// RevealUntil は，全てのカードの絵柄を見せる時間の終わりの時刻．その間はカードをめくれない．見せる時間が無ければゼロ値．
+// Version は，ゲームの状態が変わるたびに増える番号．クライアントが状態の変化を知るための ETag に用いる．
+// DailyDate は，日替わりの盤面のゲームの場合はその日付．そうでなければ空文字列．
+// Unranked は，成績をリーダーボードに記録しないゲームかどうか．保存された状態から再開したゲームは記録しない．
+// MismatchDelay は，揃わなかった2枚のカードを自動で裏に戻すまでの時間．0 の場合は次にめくるまで表のままとする．
+// MismatchResetAt は，表になっている揃わなかった2枚のカードを裏に戻す時刻．自動で戻さない場合はゼロ値．
+type Game struct {
+	Token      string
+	Board      *Board
+	Theme      string
+	FaceUp     []int
+	Moves      int
+	Matches    int
+	HintsUsed  int
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Deadline   time.Time
+	Failed     bool
+	Replay     []Move
+
+	ReplayTruncated bool
+
+	RevealUntil time.Time
+	Version     int
+	DailyDate   string
+	Unranked    bool
+
+	MismatchDelay   time.Duration
+	MismatchResetAt time.Time
+}
+
+// 盤面を受け取り，その盤面で新しく始めるゲームを戻り値として返す．
+//
+// ゲームのトークンを発行できなかった場合はエラーを返す．
+func NewGame(board *Board) (*Game, error) {
+	token, err := newRandomID()
+	if err != nil {
+		return nil, err
+	}
+	return &Game{Token: token, Board: board, StartedAt: time.Now()}, nil
+}
+
+// 制限時間を受け取り，ゲームを始めた時刻からその時間が経つまでに終えなければならないゲームとする．
+//
+// 全てのカードの絵柄を見せる時間がある場合は，その時間が終わってから制限時間を数え始める．
+// 期限は StartedAt の単調時計の読みを引き継ぐため，壁時計が変更されても期限までの時間は変わらない．
+func (game *Game) setTimeLimit(limit time.Duration) {
+	start := game.StartedAt
+	if !game.RevealUntil.IsZero() {
+		start = game.RevealUntil
+	}
+	game.Deadline = start.Add(limit)
+}
+
+// 時間を受け取り，ゲームを始めてからその時間が経つまでの間は全てのカードの絵柄を見せるゲームとする．
+//
+// setTimeLimit より先に呼ぶこと．
+func (game *Game) setRevealPeriod(period time.Duration) {
+	game.RevealUntil = game.StartedAt.Add(period)
+}
+
+// 時刻 now に全てのカードの絵柄を見せている最中かどうかを戻り値として返す．
+func (game *Game) IsRevealing(now time.Time) bool {
+	return now.Before(game.RevealUntil)
+}
+
+// 揃わなかった2枚のカードを，delay が経つと次にめくるのを待たずに裏に戻すゲームとする．
+//
+// 裏に戻すのは，次に状態を読み出すかカードをめくった時点で resetMismatch によって行う．
+func (game *Game) setMismatchReset(delay time.Duration) {
+	game.MismatchDelay = delay
+}
+
+// 時刻 now に，揃わなかった2枚のカードを裏に戻す時刻を過ぎていれば，それらを裏に戻す．
+func (game *Game) resetMismatch(now time.Time) {
+	if len(game.FaceUp) != 2 || game.MismatchResetAt.IsZero() || now.Before(game.MismatchResetAt) {
+		return
+	}
+	game.FaceUp = nil
+	game.MismatchResetAt = time.Time{}
+	game.Version++
+}
+
+// 制限時間のあるゲームかどうかを戻り値として返す．
+func (game *Game) IsTimed() bool {
+	return !game.Deadline.IsZero()
+}
+
+// 時刻 now における残り時間を戻り値として返す．
+//
+// ゲームを終えている場合は，終えた時刻における残り時間を返す．
+// 期限を過ぎている場合は 0 を返す．制限時間の無いゲームでは意味を持たない．
+func (game *Game) Remaining(now time.Time) time.Duration {
+	if !game.FinishedAt.IsZero() {
+		now = game.FinishedAt
+	}
+	return max(game.Deadline.Sub(now), 0)
+}
+
+// 時刻 now に制限時間を過ぎているか確認し，過ぎていればゲームを失敗とした上で errTimeUp を返す．
+//
+// 既に終えたゲームや制限時間の無いゲームでは常に nil を返す．
+func (game *Game) checkDeadline(now time.Time) error {
+	if game.Failed {
+		return errTimeUp
+	}
+	if !game.IsTimed() || game.IsComplete() || now.Before(game.Deadline) {
+		return nil
+	}
+	game.Failed = true
+	game.FaceUp = nil
+	game.Version++
+	return errTimeUp
+}
+
+// ゲームを始めてから時刻 now までの経過時間を戻り値として返す．
+//
+// ゲームを終えている場合は，終えた時刻までの経過時間を返す．
+func (game *Game) Elapsed(now time.Time) time.Duration {
+	if !game.FinishedAt.IsZero() {
+		now = game.FinishedAt
+	}
+	return now.Sub(game.StartedAt)
+}
+
+// 全ての組が揃い，ゲームが終わったかどうかを戻り値として返す．
+func (game *Game) IsComplete() bool {
+	return game.Matches == len(game.Board.Cards)/2
+}
+
+// card 番目のカードをめくり，それにより絵柄の組が揃ったかどうかを戻り値として返す．
+//
+// 揃わなかった2枚のカードが表になっている場合は，裏に戻す時刻の前であっても，それらを裏に戻してからめくる．
+// 範囲外のカードには errCardOutOfRange を，揃っているか表になっているカードには errCardUnavailable を返す．
+// 制限時間を過ぎている場合は，ゲームを失敗として errTimeUp を返す．
+// 全てのカードの絵柄を見せている間は，めくらずに errRevealing を返す．
+func (game *Game) Flip(card int) (bool, error) {
+	now := time.Now()
+	err := game.checkDeadline(now)
+	if err != nil {
+		return false, err
+	}
+	if card < 0 || card >= len(game.Board.Cards) {
+		return false, errCardOutOfRange
+	}
+	if game.IsRevealing(now) {
+		return false, errRevealing
+	}
+	game.resetMismatch(now)
+
+	// 前回揃わなかった2枚のカードを裏に戻す．
+	if len(game.FaceUp) == 2 {
+		game.FaceUp = nil
+		game.MismatchResetAt = time.Time{}
+		game.Version++
+	}
+
+	// めくれないカードを除く．状態は変わらないため，Version も増やさない．
+	if game.Board.Cards[card].Matched || game.isFaceUp(card) {
+		return false, errCardUnavailable
+	}
+	game.Version++
+	game.FaceUp = append(game.FaceUp, card)
+	if len(game.FaceUp) < 2 {
+		game.record(card, false)
+		return false, nil
+	}
+
+	// 2枚目をめくった場合は，絵柄が揃ったか判定する．
+	game.Moves++
+	first := &game.Board.Cards[game.FaceUp[0]]
+	second := &game.Board.Cards[game.FaceUp[1]]
+	if first.ID != second.ID {
+		if game.MismatchDelay > 0 {
+			game.MismatchResetAt = now.Add(game.MismatchDelay)
+		}
+		game.record(card, false)
+		return false, nil
+	}
+	first.Matched = true
+	second.Matched = true
+	game.Matches++
+	game.FaceUp = nil
+	game.record(card, true)
+	if game.IsComplete() {
+		game.FinishedAt = time.Now()
+	}
+
+	return true, nil
+}
+
+// card 番目のカードをめくったことを記録する．記録が maxReplayMoves 件に達している場合は記録せず，途中で終わった記録とする．
+func (game *Game) record(card int, matched bool) {
+	if len(game.Replay) >= maxReplayMoves {
+		game.ReplayTruncated = true
+		return
+	}
+	game.Replay = append(game.Replay, Move{CardIndex: card, At: time.Since(game.StartedAt), Matched: matched})
+}
+
+// 揃えていない組を random を用いてランダムに1つ選び，その2枚のカードの番号を戻り値として返す．
+//
+// ヒントの使用回数が maxHints に達している場合は errNoHintsLeft を，揃えていない組が無い場合は errNothingToHint を，
+// 制限時間を過ぎている場合は errTimeUp を返す．
+func (game *Game) Hint(maxHints int, random *rand.Rand) (first, second int, err error) {
+	err = game.checkDeadline(time.Now())
+	if err != nil {
+		return 0, 0, err
+	}
+	if game.HintsUsed >= maxHints {
+		return 0, 0, errNoHintsLeft
+	}
+
+	// 揃えていない絵柄ごとに，カードの番号を集める．
+	unmatched := map[int][]int{}
+	ids := []int{}
+	for i, card := range game.Board.Cards {
+		if card.Matched {
+			continue
+		}
+		if _, ok := unmatched[card.ID]; !ok {
+			ids = append(ids, card.ID)
+		}
+		unmatched[card.ID] = append(unmatched[card.ID], i)
+	}
+	if len(ids) == 0 {
+		return 0, 0, errNothingToHint
+	}
+
+	game.HintsUsed++
+	game.Version++
+	pair := unmatched[ids[random.Intn(len(ids))]]
+	return pair[0], pair[1], nil
+}
+
+// card 番目のカードが表になっているかどうかを戻り値として返す．
+func (game *Game) isFaceUp(card int) bool {
+	for _, faceUp := range game.FaceUp {
+		if faceUp == card {
+			return true
+		}
+	}
+	return false
+}
+
+// ゲームを終えたときの成績．
+//
+// Moves は，2枚のカードをめくった回数．
+// DurationSeconds は，ゲームを始めてから終えるまでの秒数．
+// Hints は，ヒントを使った回数．
+// Points は，Moves，Hints，DurationSeconds から calcPoints で計算した得点．
+type Score struct {
+	Moves           int     `json:"moves"`
+	Hints           int     `json:"hints"`
+	DurationSeconds float64 `json:"durationSeconds"`
+	Points          int     `json:"points"`
+}
+
+// 得点の計算に用いる定数．
+const (
+	basePoints      = 10000
+	pointsPerMove   = 100
+	pointsPerHint   = 500
+	pointsPerSecond = 10
+)
+
+// めくった回数，ヒントを使った回数，経過時間を受け取り，得点を戻り値として返す．
+//
+// 得点は basePoints から，1回めくるごとに pointsPerMove を，ヒントを1回使うごとに pointsPerHint を，
+// 1秒経つごとに pointsPerSecond を引いた値とする．
+// 少ない回数で早く終えるほど得点が高くなる．得点は負にならない．
+func calcPoints(moves int, hints int, duration time.Duration) int {
+	points := basePoints - pointsPerMove*moves - pointsPerHint*hints - int(pointsPerSecond*duration.Seconds())
+	return max(points, 0)
+}
+
+// ゲームの成績を戻り値として返す．
+//
+// ゲームが終わっていない場合は，現在時刻までの経過時間で計算する．
+func (game *Game) FinalScore() Score {
+	duration := game.Elapsed(time.Now())
+
+	return Score{
+		Moves:           game.Moves,
+		Hints:           game.HintsUsed,
+		DurationSeconds: duration.Seconds(),
+		Points:          calcPoints(game.Moves, game.HintsUsed, duration),
+	}
+}
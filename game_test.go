@@ -0,0 +1,249 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// 全てのカードの絵柄を見せている間はめくれず，見せ終わった後は通常どおりめくって手数に数えることを確認する．
+func TestFlipDuringReveal(t *testing.T) {
+	tests := []struct {
+		name        string
+		revealEnds  time.Duration
+		wantErr     error
+		wantMoves   int
+		wantMatches int
+	}{
+		{name: "during the reveal window", revealEnds: time.Minute, wantErr: errRevealing},
+		{name: "after the reveal window", revealEnds: -time.Second, wantMoves: 1, wantMatches: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			game, err := NewGame(newTestBoard(0, 0))
+			if err != nil {
+				t.Fatalf("NewGame: %v", err)
+			}
+			game.RevealUntil = time.Now().Add(test.revealEnds)
+
+			_, err = game.Flip(0)
+			if err == nil {
+				_, err = game.Flip(1)
+			}
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("Flip error = %v, want %v", err, test.wantErr)
+			}
+			if game.Moves != test.wantMoves || game.Matches != test.wantMatches {
+				t.Errorf("moves, matches = %d, %d, want %d, %d", game.Moves, game.Matches, test.wantMoves, test.wantMatches)
+			}
+		})
+	}
+}
+
+// 絵柄を見せている間のめくりに，POST /api/flip が Retry-After ヘッダ付きの 409 を返すことを確認する．
+func TestFlipHandlerDuringReveal(t *testing.T) {
+	server := newTestServer(t, newTestConfig(t))
+	client := server.newClient()
+
+	response := server.do(client, http.MethodPost, "/api/new?pairs=2&revealSeconds=30", nil)
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("POST /api/new: status %d: %s", response.StatusCode, readBody(t, response))
+	}
+	response = server.do(client, http.MethodPost, "/api/flip", flipRequest{Card: 0})
+	if response.StatusCode != http.StatusConflict {
+		t.Fatalf("status = %d, want %d", response.StatusCode, http.StatusConflict)
+	}
+	if got := response.Header.Get("Retry-After"); got != "30" {
+		t.Errorf("Retry-After = %q, want %q", got, "30")
+	}
+}
+
+// めくり方の記録が maxReplayMoves 件を超えた場合に限り，記録が途中で終わったものとされることを確認する．
+func TestReplayTruncated(t *testing.T) {
+	tests := []struct {
+		name       string
+		mismatches int
+		want       bool
+	}{
+		{name: "short game", mismatches: 1, want: false},
+		{name: "exactly at the limit", mismatches: maxReplayMoves/2 - 2, want: false},
+		{name: "over the limit", mismatches: maxReplayMoves / 2, want: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			game, err := NewGame(newTestBoard(0, 1, 0, 1))
+			if err != nil {
+				t.Fatalf("NewGame: %v", err)
+			}
+			flips := []int{}
+			for range test.mismatches {
+				flips = append(flips, 0, 1)
+			}
+			for _, card := range append(flips, 0, 2, 1, 3) {
+				_, err := game.Flip(card)
+				if err != nil {
+					t.Fatalf("Flip(%d): %v", card, err)
+				}
+			}
+			if !game.IsComplete() {
+				t.Fatal("game is not complete")
+			}
+			if game.ReplayTruncated != test.want {
+				t.Errorf("ReplayTruncated = %v with %d recorded of %d moves, want %v", game.ReplayTruncated, len(game.Replay), game.Moves, test.want)
+			}
+		})
+	}
+}
+
+// 揃わなかった2枚のカードが，MismatchDelay の間は表のままで，その後は自動で裏に戻ることを確認する．
+func TestResetMismatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		delay      time.Duration
+		after      time.Duration
+		wantFaceUp int
+	}{
+		{name: "before the window ends", delay: time.Second, after: 500 * time.Millisecond, wantFaceUp: 2},
+		{name: "after the window ends", delay: time.Second, after: 1500 * time.Millisecond, wantFaceUp: 0},
+		{name: "without automatic reset", delay: 0, after: time.Hour, wantFaceUp: 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			game, err := NewGame(newTestBoard(0, 1, 0, 1))
+			if err != nil {
+				t.Fatalf("NewGame: %v", err)
+			}
+			game.setMismatchReset(test.delay)
+			game.Flip(0)
+			game.Flip(1)
+			version := game.Version
+
+			game.resetMismatch(time.Now().Add(test.after))
+			if len(game.FaceUp) != test.wantFaceUp {
+				t.Errorf("%d cards face up, want %d", len(game.FaceUp), test.wantFaceUp)
+			}
+			if changed := game.Version != version; changed != (test.wantFaceUp == 0) {
+				t.Errorf("Version changed = %v, want %v", changed, test.wantFaceUp == 0)
+			}
+		})
+	}
+}
+
+// MismatchResetMillis を設定した場合に，揃わなかった直後のめくりと状態の問い合わせは2枚を表のまま扱い，
+// 時間が過ぎた後の問い合わせでは裏に戻した新しい状態を返すことを確認する．
+func TestMismatchResetHandlers(t *testing.T) {
+	const delay = 200 * time.Millisecond
+	config := newTestConfig(t)
+	config.MismatchResetMillis = int(delay.Milliseconds())
+	server := newTestServer(t, config)
+	client := server.newClient()
+
+	var created newGameResponse
+	decodeBody(t, server.do(client, http.MethodPost, "/api/new?pairs=2", nil), &created)
+	var first, second int
+	server.app.sessions.lookupToken(created.Token, func(game *Game) {
+		for i, card := range game.Board.Cards {
+			if card.ID != game.Board.Cards[0].ID {
+				second = i
+			}
+		}
+	})
+	faceUp := func() int {
+		count := 0
+		server.app.sessions.lookupToken(created.Token, func(game *Game) {
+			count = len(game.FaceUp)
+		})
+		return count
+	}
+
+	server.do(client, http.MethodPost, "/api/flip", flipRequest{Card: first})
+	var flipped flipResponse
+	decodeBody(t, server.do(client, http.MethodPost, "/api/flip", flipRequest{Card: second}), &flipped)
+	if flipped.ResetAfterMs <= 0 || flipped.ResetAfterMs > delay.Milliseconds() {
+		t.Errorf("resetAfterMs = %d, want within (0, %d]", flipped.ResetAfterMs, delay.Milliseconds())
+	}
+
+	// 時間が過ぎる前は，問い合わせても2枚は表のままで，ETag も変わらない．
+	response := server.do(client, http.MethodGet, "/api/status", nil)
+	etag := response.Header.Get("ETag")
+	response = server.do(client, http.MethodGet, "/api/status", nil, "If-None-Match", etag)
+	if response.StatusCode != http.StatusNotModified || faceUp() != 2 {
+		t.Errorf("before the window ends: status %d with %d cards face up, want 304 with 2", response.StatusCode, faceUp())
+	}
+
+	// 時間が過ぎた後は，問い合わせると2枚を裏に戻した新しい状態を返す．
+	time.Sleep(delay + 50*time.Millisecond)
+	response = server.do(client, http.MethodGet, "/api/status", nil, "If-None-Match", etag)
+	if response.StatusCode != http.StatusOK || faceUp() != 0 {
+		t.Errorf("after the window ends: status %d with %d cards face up, want 200 with none", response.StatusCode, faceUp())
+	}
+
+	// 裏に戻った後は，同じカードを再びめくれる．
+	response = server.do(client, http.MethodPost, "/api/flip", flipRequest{Card: first})
+	if response.StatusCode != http.StatusOK || faceUp() != 1 {
+		t.Errorf("flip after the window: status %d with %d cards face up, want 200 with 1", response.StatusCode, faceUp())
+	}
+}
+
+// 絵柄を見せている間は GET /api/status が全てのカードの絵柄を返し，見せ終わった後は絵柄を返さずにめくりを手数に数えることを確認する．
+func TestStatusDuringReveal(t *testing.T) {
+	server := newTestServer(t, newTestConfig(t))
+	client := server.newClient()
+
+	var created newGameResponse
+	decodeBody(t, server.do(client, http.MethodPost, "/api/new?pairs=2&revealSeconds=30", nil), &created)
+
+	var status statusResponse
+	decodeBody(t, server.do(client, http.MethodGet, "/api/status", nil), &status)
+	if !status.Revealing || len(status.Cards) != created.Cards {
+		t.Fatalf("revealing = %v with %d cards, want true with %d", status.Revealing, len(status.Cards), created.Cards)
+	}
+	for i, card := range status.Cards {
+		if card.ImageURL == "" {
+			t.Errorf("card %d is hidden during the reveal window", i)
+		}
+	}
+
+	// 見せる時間を終わらせる．
+	server.app.sessions.lookupToken(created.Token, func(game *Game) {
+		game.RevealUntil = time.Now().Add(-time.Second)
+	})
+	status = statusResponse{}
+	decodeBody(t, server.do(client, http.MethodGet, "/api/status", nil), &status)
+	if status.Revealing || status.Cards != nil {
+		t.Errorf("after the reveal window: revealing = %v with %d cards, want false with none", status.Revealing, len(status.Cards))
+	}
+	server.do(client, http.MethodPost, "/api/flip", flipRequest{Card: 0})
+	var flipped flipResponse
+	decodeBody(t, server.do(client, http.MethodPost, "/api/flip", flipRequest{Card: 1}), &flipped)
+	if flipped.Moves != 1 {
+		t.Errorf("moves = %d after two flips, want 1", flipped.Moves)
+	}
+}
+
+// calcPoints が，めくった回数，ヒントを使った回数，経過時間に応じて得点を減らし，負にならないことを確認する．
+func TestCalcPoints(t *testing.T) {
+	tests := []struct {
+		name     string
+		moves    int
+		hints    int
+		duration time.Duration
+		want     int
+	}{
+		{name: "no moves", want: basePoints},
+		{name: "normal", moves: 10, duration: 30 * time.Second, want: basePoints - 10*pointsPerMove - 30*pointsPerSecond},
+		{name: "partial seconds", moves: 8, duration: 1500 * time.Millisecond, want: basePoints - 8*pointsPerMove - 15},
+		{name: "hints", moves: 10, hints: 2, duration: 30 * time.Second, want: basePoints - 10*pointsPerMove - 2*pointsPerHint - 30*pointsPerSecond},
+		{name: "clamped by moves", moves: 200, want: 0},
+		{name: "clamped by time", moves: 8, duration: time.Hour, want: 0},
+		{name: "clamped by hints", hints: 30, want: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := calcPoints(test.moves, test.hints, test.duration); got != test.want {
+				t.Errorf("calcPoints(%d, %d, %v) = %d, want %d", test.moves, test.hints, test.duration, got, test.want)
+			}
+		})
+	}
+}
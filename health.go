@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// GET /healthz のレスポンスの形式．
+//
+// Error は，サーバーがゲームを提供できない場合の理由．
+type healthResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ゲームの提供に必要な画像ディレクトリと成績ファイルが読み出せるか確認し，読み出せない場合はその理由とエラーを返す．
+//
+// 理由は確認ごとに決まった文言とし，サーバーのパスなどを含むエラーの詳細はログにのみ記録すること．
+// 成績ファイルはまだ作られていなくてもよいが，その場合は作成先のディレクトリが存在する必要がある．
+func checkResources(config *Configuration) (string, error) {
+	_, err := os.ReadDir(config.ImageDir)
+	if err != nil {
+		return "image directory unavailable", err
+	}
+
+	file, err := os.Open(config.ScoresFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		_, err = os.Stat(filepath.Dir(config.ScoresFile))
+		if err != nil {
+			return "scores directory unavailable", err
+		}
+		return "", nil
+	}
+	if err != nil {
+		return "scores file unavailable", err
+	}
+	file.Close()
+
+	return "", nil
+}
+
+// GET /healthz を処理し，サーバーがゲームを提供できる状態かどうかを JSON として返す．
+//
+// ゲームの状態やテンプレートには触れず，必要なファイルが読み出せない場合は 503 を返す．
+// 認証なしで公開するため，レスポンスには決まった理由のみを含め，エラーの詳細はログに記録する．
+func (app *application) healthHandler(writer http.ResponseWriter, request *http.Request) {
+	reason, err := checkResources(app.config)
+	if err != nil {
+		logRequestError(request, "Health check failed:", reason, err)
+		writeJSON(writer, http.StatusServiceUnavailable, healthResponse{Status: "unavailable", Error: reason})
+		return
+	}
+	writeJSON(writer, http.StatusOK, healthResponse{Status: "ok"})
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// GET /healthz が，必要なファイルを読み出せない場合に 503 と決まった理由のみを返し，サーバーのパスを明かさないことを確認する．
+func TestHealthHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		modify     func(config *Configuration, missing string)
+		wantStatus int
+		wantError  string
+	}{
+		{name: "healthy", modify: func(*Configuration, string) {}, wantStatus: http.StatusOK},
+		{
+			name:       "missing image directory",
+			modify:     func(config *Configuration, missing string) { config.ImageDir = missing },
+			wantStatus: http.StatusServiceUnavailable,
+			wantError:  "image directory unavailable",
+		},
+		{
+			name:       "missing scores directory",
+			modify:     func(config *Configuration, missing string) { config.ScoresFile = filepath.Join(missing, "scores.json") },
+			wantStatus: http.StatusServiceUnavailable,
+			wantError:  "scores directory unavailable",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t, newTestConfig(t))
+			missing := filepath.Join(t.TempDir(), "missing")
+			test.modify(server.app.config, missing)
+
+			var health healthResponse
+			response := server.do(server.newClient(), http.MethodGet, "/healthz", nil)
+			decodeBody(t, response, &health)
+			if response.StatusCode != test.wantStatus || health.Error != test.wantError {
+				t.Errorf("status %d, error %q, want %d, %q", response.StatusCode, health.Error, test.wantStatus, test.wantError)
+			}
+			if strings.Contains(health.Error, missing) {
+				t.Errorf("error %q reveals the server path", health.Error)
+			}
+		})
+	}
+}
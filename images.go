@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 画像ディレクトリを配信する URL の接頭辞．
+const imageURLPrefix = "/images/"
+
+// 画像ディレクトリ直下の画像からなる，既定のテーマの名前．
+const defaultTheme = ""
+
+// カードの絵柄として用いる画像ファイルの拡張子．
+var imageExtensions = map[string]bool{
+	".png": true,
+	".jpg": true,
+	".gif": true,
+}
+
+// テーマの名前ごとに，そのテーマに含まれる画像の URL の一覧を保持する型．
+type imageThemes map[string][]string
+
+// テーマの名前の一覧を名前順に並べて戻り値として返す．
+func (themes imageThemes) names() []string {
+	names := make([]string, 0, len(themes))
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// dir 直下の画像ファイルを探し，urlPrefix にファイル名を繋げた URL の一覧を名前順に並べて戻り値として返す．
+func scanImages(dir string, urlPrefix string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	urls := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() || !imageExtensions[strings.ToLower(filepath.Ext(entry.Name()))] {
+			continue
+		}
+		urls = append(urls, urlPrefix+entry.Name())
+	}
+	sort.Strings(urls)
+
+	return urls, nil
+}
+
+// dir 直下の画像を既定のテーマとし，各サブディレクトリの画像をそのディレクトリ名のテーマとして読み込む．
+//
+// 画像の URL は，画像ディレクトリを配信する URL の接頭辞 urlPrefix にディレクトリ中のパスを繋げたものとする．
+func loadThemes(dir string, urlPrefix string) (imageThemes, error) {
+	images, err := scanImages(dir, urlPrefix)
+	if err != nil {
+		return nil, err
+	}
+	themes := imageThemes{defaultTheme: images}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		themeImages, err := scanImages(filepath.Join(dir, entry.Name()), path.Join(urlPrefix, entry.Name())+"/")
+		if err != nil {
+			return nil, err
+		}
+		themes[entry.Name()] = themeImages
+	}
+
+	return themes, nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// リーダーボードに保持する成績の最大件数．
+const maxLeaderboardEntries = 100
+
+// リーダーボードに記録するプレイヤーの名前の最大文字数．
+const maxPlayerNameRunes = 24
+
+// 表示できない文字のうち，絵文字を組み立てるために用いる文字であれば true を返す．
+//
+// ゼロ幅接合子 (U+200D) は家族などの絵文字を，タグ文字 (U+E0020 から U+E007F) はスコットランドなどの旗の絵文字を組み立てる．
+func isEmojiJoiner(r rune) bool {
+	return r == '\u200d' || (r >= '\U000e0020' && r <= '\U000e007f')
+}
+
+// プレイヤーの名前を受け取り，リーダーボードに記録できる形に整えて戻り値として返す．
+//
+// 全角空白やタブなどの空白文字は半角空白に揃え，それ以外の制御文字などの表示できない文字を取り除き，前後の空白を除く．
+// ただし，複数の文字を組み合わせた絵文字を崩さないよう，ゼロ幅接合子と地域の旗に用いるタグ文字は残す．
+// 結果が空になる場合や maxPlayerNameRunes 文字を超える場合はエラーを返す．
+func sanitizeName(name string) (string, error) {
+	if !utf8.ValidString(name) {
+		return "", errors.New("name must be valid UTF-8")
+	}
+	printable := strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsSpace(r):
+			return ' '
+		case unicode.IsPrint(r), isEmojiJoiner(r):
+			return r
+		default:
+			return -1
+		}
+	}, name)
+	printable = strings.TrimSpace(printable)
+
+	if printable == "" {
+		return "", errors.New("name must not be empty")
+	}
+	if utf8.RuneCountInString(printable) > maxPlayerNameRunes {
+		return "", fmt.Errorf("name must be at most %d characters", maxPlayerNameRunes)
+	}
+	return printable, nil
+}
+
+// リーダーボードに記録された1件の成績．
+//
+// Name は，成績を記録したプレイヤーの名前．
+// RecordedAt は，成績を記録した時刻．
+type LeaderboardEntry struct {
+	Name       string    `json:"name"`
+	Score      Score     `json:"score"`
+	RecordedAt time.Time `json:"recordedAt"`
+}
+
+// 得点の高い順に成績を保持し，JSON ファイルに保存する ScoreStore．
+//
+// 複数のゲームが同時に終わってもファイルが壊れないよう，全ての操作は mutex で直列化する．
+type FileScoreStore struct {
+	mutex   sync.Mutex
+	path    string
+	entries []LeaderboardEntry
+}
+
+// path の JSON ファイルから成績を読み出し，そのファイルに保存する ScoreStore を戻り値として返す．
+//
+// ファイルがまだ無い場合は，成績が空の ScoreStore を返す．
+// ファイルを JSON として読めない場合は，path.corrupt-日時 に退避した上で，成績が空の ScoreStore を返す．
+func openFileScoreStore(path string) (*FileScoreStore, error) {
+	leaderboard := &FileScoreStore{path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return leaderboard, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &leaderboard.entries)
+	if err != nil {
+		// 壊れたファイルで起動できなくなったり，次に保存した際に上書きして失ったりしないよう，退避してから空で始める．
+		backup := fmt.Sprintf("%s.corrupt-%s", path, time.Now().UTC().Format("20060102T150405Z"))
+		renameErr := os.Rename(path, backup)
+		if renameErr != nil {
+			return nil, fmt.Errorf("cannot decode scores (%v) nor back them up: %w", err, renameErr)
+		}
+		logError("Cannot decode scores, moved", path, "to", backup, "and starting with no scores:", err)
+		return &FileScoreStore{path: path}, nil
+	}
+	leaderboard.sortEntries()
+
+	return leaderboard, nil
+}
+
+// プレイヤーの名前と成績を受け取ってリーダーボードに追加し，ファイルに保存する．
+//
+// 上位 maxLeaderboardEntries 件に入らない成績は保持しない．
+func (leaderboard *FileScoreStore) Add(name string, score Score) error {
+	leaderboard.mutex.Lock()
+	defer leaderboard.mutex.Unlock()
+
+	entry := LeaderboardEntry{Name: name, Score: score, RecordedAt: time.Now()}
+	leaderboard.entries = append(leaderboard.entries, entry)
+	leaderboard.sortEntries()
+	if len(leaderboard.entries) > maxLeaderboardEntries {
+		leaderboard.entries = leaderboard.entries[:maxLeaderboardEntries]
+	}
+
+	return leaderboard.save()
+}
+
+// 得点の高い順に最大 n 件の成績を戻り値として返す．
+func (leaderboard *FileScoreStore) Top(n int) ([]LeaderboardEntry, error) {
+	leaderboard.mutex.Lock()
+	defer leaderboard.mutex.Unlock()
+
+	n = min(n, len(leaderboard.entries))
+	top := make([]LeaderboardEntry, n)
+	copy(top, leaderboard.entries[:n])
+	return top, nil
+}
+
+// 保持している成績の件数を戻り値として返す．
+func (leaderboard *FileScoreStore) Len() (int, error) {
+	leaderboard.mutex.Lock()
+	defer leaderboard.mutex.Unlock()
+
+	return len(leaderboard.entries), nil
+}
+
+// 成績は追加するたびにファイルへ保存しているため，閉じる際に行うことは無い．
+func (leaderboard *FileScoreStore) Close() error {
+	return nil
+}
+
+// 成績を得点の高い順に並べ替える．同点の場合は先に記録された成績を上位とする．
+func (leaderboard *FileScoreStore) sortEntries() {
+	sort.SliceStable(leaderboard.entries, func(i, j int) bool {
+		return leaderboard.entries[i].Score.Points > leaderboard.entries[j].Score.Points
+	})
+}
+
+// 保持している成績をファイルに保存する．呼び出し側で mutex を獲得しておくこと．
+//
+// 書き込み途中で終了してもファイルが壊れないよう，一時ファイルに書き込んでから置き換える．
+func (leaderboard *FileScoreStore) save() error {
+	data, err := json.MarshalIndent(leaderboard.entries, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(leaderboard.path), filepath.Base(leaderboard.path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	err = temp.Chmod(0644)
+	if err != nil {
+		temp.Close()
+		return err
+	}
+	_, err = temp.Write(data)
+	if err != nil {
+		temp.Close()
+		return err
+	}
+	err = temp.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(temp.Name(), leaderboard.path)
+}
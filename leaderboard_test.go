@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// sanitizeName が日本語や絵文字の名前をそのまま残し，表示できない文字を取り除き，長すぎる名前を拒否することを確認する．
+func TestSanitizeName(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{name: "ascii", input: "alice", want: "alice"},
+		{name: "japanese", input: "山田　太郎", want: "山田 太郎"},
+		{name: "combining mark", input: "Zoë", want: "Zoë"},
+		{name: "single emoji", input: "🐱", want: "🐱"},
+		{name: "emoji with variation selector", input: "❤️", want: "❤️"},
+		{name: "emoji joined by ZWJ", input: "👨‍👩‍👧‍👦", want: "👨‍👩‍👧‍👦"},
+		{name: "emoji with skin tone", input: "👋🏽", want: "👋🏽"},
+		{name: "subdivision flag", input: "🏴\U000e0067\U000e0062\U000e0073\U000e0063\U000e0074\U000e007f", want: "🏴\U000e0067\U000e0062\U000e0073\U000e0063\U000e0074\U000e007f"},
+		{name: "control characters", input: "bob\x00\x1b[31m\n", want: "bob[31m"},
+		{name: "bidi override", input: "\u202eevil", want: "evil"},
+		{name: "surrounding spaces", input: "  carol\t", want: "carol"},
+		{name: "at the limit", input: strings.Repeat("あ", maxPlayerNameRunes), want: strings.Repeat("あ", maxPlayerNameRunes)},
+		{name: "empty", input: "", wantErr: true},
+		{name: "only spaces", input: " 　\t", wantErr: true},
+		{name: "only control characters", input: "\x00\x07", wantErr: true},
+		{name: "oversized", input: strings.Repeat("あ", maxPlayerNameRunes+1), wantErr: true},
+		{name: "oversized after trimming", input: " " + strings.Repeat("a", 10000) + " ", wantErr: true},
+		{name: "invalid UTF-8", input: "a\xffb", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := sanitizeName(test.input)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("sanitizeName(%q) = %q, want an error", test.input, got)
+				}
+				return
+			}
+			if err != nil || got != test.want {
+				t.Errorf("sanitizeName(%q) = %q, %v, want %q", test.input, got, err, test.want)
+			}
+		})
+	}
+}
+
+// 壊れた成績のファイルを .corrupt- 付きのファイルに退避し，成績が空のままサーバーが動き続けることを確認する．
+func TestCorruptScoresFile(t *testing.T) {
+	config := newTestConfig(t)
+	corrupt := []byte(`[{"name": "alice", "score":`)
+	err := os.WriteFile(config.ScoresFile, corrupt, 0o644)
+	if err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	server := newTestServer(t, config)
+
+	backups, err := filepath.Glob(config.ScoresFile + ".corrupt-*")
+	if err != nil || len(backups) != 1 {
+		t.Fatalf("backups = %v, %v, want exactly one", backups, err)
+	}
+	data, err := os.ReadFile(backups[0])
+	if err != nil || !bytes.Equal(data, corrupt) {
+		t.Errorf("backup holds %q, %v, want the corrupt contents", data, err)
+	}
+
+	client := server.newClient()
+	response := server.do(client, http.MethodGet, "/api/leaderboard", nil)
+	if body := strings.TrimSpace(readBody(t, response)); response.StatusCode != http.StatusOK || body != "[]" {
+		t.Errorf("GET /api/leaderboard: status %d, body %s, want an empty leaderboard", response.StatusCode, body)
+	}
+	response = server.do(client, http.MethodPost, "/api/new", nil)
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("POST /api/new: status %d, want %d", response.StatusCode, http.StatusOK)
+	}
+}
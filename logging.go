@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// ログの重要度．値が大きいほど重要である．
+type logLevel int
+
+const (
+	logLevelDebug logLevel = iota
+	logLevelInfo
+	logLevelError
+)
+
+// 設定ファイルの LogLevel に指定できる名前と，それが表すログの重要度．
+var logLevels = map[string]logLevel{
+	"debug": logLevelDebug,
+	"info":  logLevelInfo,
+	"error": logLevelError,
+}
+
+// 出力するログの重要度の下限．これより重要度の低いログは出力しない．
+//
+// 起動時に setupLogging で一度だけ設定し，以降は読み出すのみとする．
+var minLogLevel = logLevelInfo
+
+// 重要度が level のログを出力するかどうかを戻り値として返す．
+func logEnabled(level logLevel) bool {
+	return level >= minLogLevel
+}
+
+// 重要度が level のログとして message を出力する．呼び出し元の位置がずれないよう，各関数から直接呼ぶこと．
+func logAt(level logLevel, message string) {
+	if !logEnabled(level) {
+		return
+	}
+	log.Output(3, message)
+}
+
+// デバッグ用の詳細なログを出力する．
+func logDebug(v ...any) {
+	logAt(logLevelDebug, fmt.Sprintln(v...))
+}
+
+// 動作の記録として通常のログを出力する．
+func logInfo(v ...any) {
+	logAt(logLevelInfo, fmt.Sprintln(v...))
+}
+
+// 書式を指定して通常のログを出力する．
+func logInfof(format string, v ...any) {
+	logAt(logLevelInfo, fmt.Sprintf(format, v...))
+}
+
+// 処理に失敗したことを表すログを出力する．
+func logError(v ...any) {
+	logAt(logLevelError, fmt.Sprintln(v...))
+}
+
+// 書式を指定して，処理に失敗したことを表すログを出力する．
+func logErrorf(format string, v ...any) {
+	logAt(logLevelError, fmt.Sprintf(format, v...))
+}
+
+// リクエストのコンテキストからリクエスト ID を取り出し，ログの行の先頭に付ける "[ID] " の形式の文字列を戻り値として返す．
+//
+// リクエスト ID が無い場合は空文字列を返す．
+func requestLogPrefix(ctx context.Context) string {
+	id := requestIDFromContext(ctx)
+	if id == "" {
+		return ""
+	}
+	return "[" + id + "] "
+}
+
+// リクエストの処理に失敗したことを表すログを，そのリクエストの ID を付けて出力する．
+func logRequestError(request *http.Request, v ...any) {
+	logAt(logLevelError, requestLogPrefix(request.Context())+fmt.Sprintln(v...))
+}
+
+// 書式を指定して，リクエストの処理に失敗したことを表すログを，そのリクエストの ID を付けて出力する．
+func logRequestErrorf(request *http.Request, format string, v ...any) {
+	logAt(logLevelError, requestLogPrefix(request.Context())+fmt.Sprintf(format, v...))
+}
+
+// 設定に従ってログの重要度の下限と出力先を設定する．
+//
+// LogFile が指定されていればそのファイルに追記し，そうでなければ標準エラー出力に出力する．
+// ファイルは追記のみで開くため，外部のツールでファイルを移動して切り替えても，再起動後は新しいファイルに書き込む．
+// 戻り値の関数は，開いたファイルを閉じる．
+func setupLogging(config *Configuration) (closeLog func() error, err error) {
+	minLogLevel = logLevels[config.LogLevel]
+
+	if config.LogFile == "" {
+		return func() error { return nil }, nil
+	}
+	file, err := os.OpenFile(config.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open log file %q: %w", config.LogFile, err)
+	}
+	setLogOutput(file)
+
+	return file.Close, nil
+}
+
+// 全てのログの出力先を writer に切り替える．
+func setLogOutput(writer io.Writer) {
+	log.SetOutput(writer)
+	jsonRequestLogger.SetOutput(writer)
+}
+
+// LogLevel に指定できる名前を，重要度の低い順にカンマ区切りで並べて戻り値として返す．
+func logLevelNames() string {
+	names := make([]string, len(logLevels))
+	for name, level := range logLevels {
+		names[level] = name
+	}
+	return strings.Join(names, ", ")
+}
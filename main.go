@@ -1,77 +1,198 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
-	"text/template"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
-// プログラム実行時の設定をまとめた構造体．
+// サーバーが保持している接続を記録する構造体．
 //
-// Host は，サーバーのIPアドレス．
-type Configuration struct {
-	Host string
+// シャットダウンが猶予時間内に終わらなかった際に，切断する接続を知るために用いる．
+type connTracker struct {
+	mutex sync.Mutex
+	conns map[net.Conn]struct{}
 }
 
-// config.json からプログラム実行時の設定を読み出し，構造体に格納して戻り値として返す．
-//
-// 成功時は構造体のアドレスを返し，失敗時は nil とエラーを返す．
-func loadConfig() (*Configuration, error) {
-	// 設定ファイルを読み出す．
-	file, err := os.Open("config.json")
-	if err != nil {
-		return nil, err
+func newConnTracker() *connTracker {
+	return &connTracker{conns: map[net.Conn]struct{}{}}
+}
+
+// http.Server の ConnState に登録し，接続の状態変化に応じて記録を更新する．
+func (tracker *connTracker) track(conn net.Conn, state http.ConnState) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	switch state {
+	case http.StateNew:
+		tracker.conns[conn] = struct{}{}
+	case http.StateHijacked, http.StateClosed:
+		delete(tracker.conns, conn)
 	}
+}
 
-	// 読み出した設定データを，構造体に格納する．
-	config := Configuration{}
-	decoder := json.NewDecoder(file)
-	err = decoder.Decode(&config)
-	if err != nil {
-		return nil, err
+// 現在保持している接続の相手先アドレスの一覧を戻り値として返す．
+func (tracker *connTracker) remoteAddrs() []string {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	addrs := make([]string, 0, len(tracker.conns))
+	for conn := range tracker.conns {
+		addrs = append(addrs, conn.RemoteAddr().String())
 	}
+	return addrs
+}
+
+// HTTPS で配信する際に，HTTP のリクエストを受け付けて転送するポート．
+const redirectHTTPPort = "80"
+
+// HTTP のリクエストを，同じホストの httpsPort 番ポートへの HTTPS のリクエストに転送するハンドラを戻り値として返す．
+func redirectToHTTPS(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		host, _, err := net.SplitHostPort(request.Host)
+		if err != nil {
+			host = request.Host
+		}
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
 
-	return &config, nil
+		target := "https://" + host + request.URL.RequestURI()
+		http.Redirect(writer, request, target, http.StatusMovedPermanently)
+	})
 }
 
-func processGame(writer http.ResponseWriter, request *http.Request) {
-	t := template.Must(template.ParseFiles("game/display.html"))
-	t.ExecuteTemplate(writer, "display", "user 様")
+// app のリクエストを処理する，サーバー全体のハンドラを戻り値として返す．
+//
+// 開発用に EnableH2C が有効にされた場合のみ，証明書を用いない HTTP/2 の接続も受け付ける．
+func serverHandler(app *application) http.Handler {
+	handler := newRouter(app)
+	if app.config.EnableH2C {
+		return h2c.NewHandler(handler, &http2.Server{})
+	}
+	return handler
 }
 
 func main() {
+	// コマンドライン引数を解析する．
+	configFlag := flag.String("config", "", "path to the config file (overrides "+configPathEnv+")")
+	printConfig := flag.Bool("print-config", false, "print the resolved configuration as JSON and exit")
+	flag.Parse()
+
 	// 設定を読み出す．
-	config, err := loadConfig()
+	config, err := loadConfig(resolveConfigPath(*configFlag))
 	if err != nil {
 		log.Fatalln("Cannot get configuration from file", err)
 	}
 
-	// マルチプレクサを用意する．
-	mux := http.NewServeMux()
+	// 設定の確認のみを求められた場合は，既定値を補った設定を秘密にすべき値を伏せて出力して終了する．
+	if *printConfig {
+		output, err := json.MarshalIndent(config.redacted(), "", "    ")
+		if err != nil {
+			log.Fatalln("Cannot encode configuration", err)
+		}
+		fmt.Println(string(output))
+		return
+	}
 
-	// ウェブサイト表示に用いるファイル群を取得する．
-	files := http.FileServer(http.Dir("game"))
-	mux.Handle("/game/", http.StripPrefix("/game/", files))
+	// ログの出力先と重要度を設定する．
+	closeLog, err := setupLogging(config)
+	if err != nil {
+		log.Fatalln("Cannot set up logging", err)
+	}
+	defer closeLog()
 
-	// ハンドラを登録する．
-	mux.HandleFunc("/", processGame) // TODO: タイトル画面の表示
-	mux.HandleFunc("/game", processGame)
+	// 設定された保存先から成績を読み出す．
+	scores, err := openScoreStore(config.ScoreBackend, config.ScoresFile)
+	if err != nil {
+		log.Fatalln("Cannot open score store", err)
+	}
+	defer scores.Close()
 
-	// サーバーの受け付けポートとアドレスを用意する．
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	// リクエストの処理に用いる状態を用意し，参照されなくなったセッションの掃除を始める．
+	app, err := newApplication(config, scores)
+	if err != nil {
+		log.Fatalln("Cannot prepare server", err)
 	}
-	address := config.Host + ":" + port
+	defer app.dailyScores.Close()
+	stopSweeper := app.sessions.startSweeper(time.Duration(config.SweepInterval), time.Duration(config.SessionIdleTimeout))
 
 	// サーバーを起動する．
+	if config.EnableH2C {
+		logInfo("Serving HTTP/2 cleartext (h2c) for development")
+	}
+	tracker := newConnTracker()
 	server := &http.Server{
-		Addr:    address,
-		Handler: mux,
+		Addr:         config.Address,
+		Handler:      serverHandler(app),
+		ReadTimeout:  time.Duration(config.ReadTimeout),
+		WriteTimeout: time.Duration(config.WriteTimeout),
+		IdleTimeout:  time.Duration(config.IdleTimeout),
+		ConnState:    tracker.track,
 	}
+	serverErr := make(chan error, 1)
+	go func() {
+		if config.TLSEnabled() {
+			serverErr <- server.ListenAndServeTLS(config.TLSCertFile, config.TLSKeyFile)
+		} else {
+			serverErr <- server.ListenAndServe()
+		}
+	}()
 	fmt.Print("Running server...")
-	server.ListenAndServe()
+
+	// HTTPS で配信する場合は，HTTP のリクエストを HTTPS に転送するサーバーも起動する．
+	var redirectServer *http.Server
+	if config.TLSEnabled() && config.RedirectHTTP {
+		_, port, _ := net.SplitHostPort(config.Address)
+		redirectServer = &http.Server{
+			Addr:         net.JoinHostPort(config.Host, redirectHTTPPort),
+			Handler:      redirectToHTTPS(port),
+			ReadTimeout:  time.Duration(config.ReadTimeout),
+			WriteTimeout: time.Duration(config.WriteTimeout),
+			IdleTimeout:  time.Duration(config.IdleTimeout),
+		}
+		go func() {
+			serverErr <- redirectServer.ListenAndServe()
+		}()
+	}
+
+	// 終了シグナルを受け取るまで待機する．
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err := <-serverErr:
+		log.Fatalln("Server stopped unexpectedly", err)
+	case sig := <-signals:
+		logInfo("Received signal", sig, "- shutting down")
+	}
+
+	// 処理中のリクエストの完了を待ってからサーバーを停止する．
+	stopSweeper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.ShutdownTimeout))
+	defer cancel()
+	if redirectServer != nil {
+		redirectServer.Shutdown(ctx)
+	}
+	err = server.Shutdown(ctx)
+	if err != nil {
+		// 猶予時間内に終わらなかった接続は強制的に切断する．
+		logError("Graceful shutdown did not finish in time", err)
+		for _, addr := range tracker.remoteAddrs() {
+			logError("Dropping connection from", addr)
+		}
+		server.Close()
+	}
+	logInfo("Server stopped")
 }
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/net/http2"
+)
+
+// EnableH2C の設定に関わらず通常の HTTP/1.1 のリクエストを処理し，有効な場合に限り証明書を用いない HTTP/2 の接続も受け付けることを確認する．
+func TestServerHandlerH2C(t *testing.T) {
+	// 証明書を用いずに，最初から HTTP/2 で話すクライアント．
+	h2cClient := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}}
+
+	for _, enabled := range []bool{false, true} {
+		config := newTestConfig(t)
+		config.EnableH2C = enabled
+		server := httptest.NewServer(serverHandler(newTestApplication(t, config)))
+		t.Cleanup(server.Close)
+
+		response, err := http.Get(server.URL + "/healthz")
+		if err != nil {
+			t.Fatalf("EnableH2C %v: HTTP/1.1 request: %v", enabled, err)
+		}
+		response.Body.Close()
+		if response.StatusCode != http.StatusOK || response.ProtoMajor != 1 {
+			t.Errorf("EnableH2C %v: HTTP/1.1 request got %s %d, want HTTP/1.1 200", enabled, response.Proto, response.StatusCode)
+		}
+
+		response, err = h2cClient.Get(server.URL + "/healthz")
+		if err == nil {
+			response.Body.Close()
+		}
+		served := err == nil && response.StatusCode == http.StatusOK && response.ProtoMajor == 2
+		if served != enabled {
+			t.Errorf("EnableH2C %v: h2c request served = %v (%v)", enabled, served, err)
+		}
+	}
+}
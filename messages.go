@@ -0,0 +1,125 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Accept-Language ヘッダに対応する言語が無い場合に用いる言語．
+const defaultLang = "ja"
+
+// 言語ごとの，画面に表示する文言の一覧．
+//
+// キーはテンプレートから .Messages.キー として参照する．%d や %s を含む文言は，テンプレートの printf で値を埋め込む．
+// 全ての言語に同じキーを揃えること．
+var messageCatalogs = map[string]map[string]string{
+	"ja": {
+		"gameName":          "絵合わせゲーム",
+		"highScoreCount":    "これまでに記録されたハイスコアは%d件です．",
+		"startGame":         "Start Game",
+		"welcome":           "%s 様 絵合わせゲームです．",
+		"boardInfo":         "難易度は %s，盤面は %d行 %d列です．",
+		"randomness":        "乱雑さ",
+		"changeRate":        "変化の速さ",
+		"currentValueStart": "現在の値は",
+		"currentValueEnd":   "です",
+		"descriptionSoon":   "ここに説明を追記する予定です．",
+		"underConstruction": "※現在，実装途中です．",
+		"errorTitle":        "エラー",
+		"errorHeading":      "エラー %d",
+		"scoresUnavailable": "ハイスコアを読み出せませんでした．",
+		"gameUnavailable":   "ゲームを始められませんでした．",
+		"tooManyGames":      "ただいま混み合っています．しばらくしてからお試しください．",
+		"notFoundTitle":     "ページが見つかりません",
+		"notFoundMessage":   "%s というページはありません．",
+		"backToTitle":       "タイトルへ戻る",
+		"resultPlayer":      "プレイヤー: %s",
+		"resultMoves":       "手数: %d",
+		"resultTime":        "時間: %s",
+		"resultScore":       "得点: %d",
+		"anonymousName":     "名無し",
+	},
+	"en": {
+		"gameName":          "Picture Matching",
+		"highScoreCount":    "%d high scores have been recorded so far.",
+		"startGame":         "Start Game",
+		"welcome":           "Welcome, %s. This is the picture matching game.",
+		"boardInfo":         "Difficulty: %s, board: %d rows by %d columns.",
+		"randomness":        "Randomness",
+		"changeRate":        "Speed of change",
+		"currentValueStart": "Current value: ",
+		"currentValueEnd":   "",
+		"descriptionSoon":   "A description will be added here.",
+		"underConstruction": "* This page is still under construction.",
+		"errorTitle":        "Error",
+		"errorHeading":      "Error %d",
+		"scoresUnavailable": "Cannot read the high scores.",
+		"gameUnavailable":   "Cannot start the game.",
+		"tooManyGames":      "The server is busy. Please try again later.",
+		"notFoundTitle":     "Page not found",
+		"notFoundMessage":   "There is no page at %s.",
+		"backToTitle":       "Back to title",
+		"resultPlayer":      "Player: %s",
+		"resultMoves":       "Moves: %d",
+		"resultTime":        "Time: %s",
+		"resultScore":       "Score: %d",
+		"anonymousName":     "Anonymous",
+	},
+}
+
+// 言語の名前を受け取り，その言語の文言の一覧を戻り値として返す．
+//
+// 対応していない言語の場合は，日本語の文言を返す．
+func messagesFor(lang string) map[string]string {
+	messages, ok := messageCatalogs[lang]
+	if !ok {
+		return messageCatalogs[defaultLang]
+	}
+	return messages
+}
+
+// リクエストの Accept-Language ヘッダを読み取り，対応している言語のうち最も優先される言語の名前を戻り値として返す．
+//
+// "en-US" のような地域付きの指定は "en" として扱う．品質値が同じ場合は先に書かれた言語を優先し，
+// 対応している言語が1つも無い場合は defaultLang を返す．
+func langFromRequest(request *http.Request) string {
+	best := defaultLang
+	bestQuality := 0.0
+	for _, part := range strings.Split(request.Header.Get("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		lang, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		if _, ok := messageCatalogs[lang]; !ok {
+			continue
+		}
+
+		quality := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+		if quality > bestQuality {
+			best = lang
+			bestQuality = quality
+		}
+	}
+	return best
+}
+
+// 全てのページのテンプレートに共通して渡す，表示する言語とその文言．
+//
+// Lang は，ページの言語の名前．html 要素の lang 属性に用いる．
+// Messages は，その言語の文言の一覧．
+type PageText struct {
+	Lang     string
+	Messages map[string]string
+}
+
+// リクエストから表示する言語を決め，その言語の文言を戻り値として返す．
+func pageTextFor(request *http.Request) PageText {
+	lang := langFromRequest(request)
+	return PageText{Lang: lang, Messages: messagesFor(lang)}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ゲームを終えるまでの時間の分布を数える区間の上限．単位は秒．
+var completionBuckets = []float64{30, 60, 120, 300, 600, 1800}
+
+// 観測した値を区間ごとに数えるヒストグラム．
+type histogram struct {
+	mutex  sync.Mutex
+	bounds []float64
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+// 値を1つ観測し，その値を上限とする全ての区間の数を増やす．
+func (h *histogram) observe(value float64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for i, bound := range h.bounds {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+// ヒストグラムを Prometheus のテキスト形式で writer に書き出す．
+func (h *histogram) write(writer io.Writer, name string, help string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	fmt.Fprintf(writer, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for i, bound := range h.bounds {
+		fmt.Fprintf(writer, "%s_bucket{le=\"%s\"} %d\n", name, strconv.FormatFloat(bound, 'g', -1, 64), h.counts[i])
+	}
+	fmt.Fprintf(writer, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(writer, "%s_sum %g\n", name, h.sum)
+	fmt.Fprintf(writer, "%s_count %d\n", name, h.count)
+}
+
+// 運用の監視に用いる，ゲームに関する計測値．
+//
+// 複数のリクエストから同時に更新されるため，カウンタは sync/atomic で更新する．
+type metrics struct {
+	gamesStarted   atomic.Int64
+	gamesCompleted atomic.Int64
+	flips          atomic.Int64
+	completionTime *histogram
+}
+
+func newMetrics() *metrics {
+	return &metrics{completionTime: newHistogram(completionBuckets)}
+}
+
+// ゲームを終えたことを記録する．
+func (m *metrics) recordCompletion(duration time.Duration) {
+	m.gamesCompleted.Add(1)
+	m.completionTime.observe(duration.Seconds())
+}
+
+// カウンタを Prometheus のテキスト形式で writer に書き出す．
+func writeCounter(writer io.Writer, name string, help string, value int64) {
+	fmt.Fprintf(writer, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, value)
+}
+
+// ゲージを Prometheus のテキスト形式で writer に書き出す．
+func writeGauge(writer io.Writer, name string, help string, value int64) {
+	fmt.Fprintf(writer, "# HELP %s %s\n# TYPE %s gauge\n%s %d\n", name, help, name, name, value)
+}
+
+// GET /metrics を処理し，計測値を Prometheus のテキスト形式で返す．
+func (app *application) metricsHandler(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writeCounter(writer, "picmatch_games_started_total", "Number of games started.", app.metrics.gamesStarted.Load())
+	writeCounter(writer, "picmatch_games_completed_total", "Number of games completed.", app.metrics.gamesCompleted.Load())
+	writeCounter(writer, "picmatch_flips_total", "Number of cards flipped.", app.metrics.flips.Load())
+	writeGauge(writer, "picmatch_active_games", "Number of games currently held in sessions.", int64(app.sessions.count()))
+	app.metrics.completionTime.write(writer, "picmatch_game_completion_seconds", "Time taken to complete a game.")
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// リクエストログの出力形式．
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// レスポンスのステータスコードと大きさを記録する http.ResponseWriter．
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (writer *responseWriter) WriteHeader(status int) {
+	if writer.status == 0 {
+		writer.status = status
+	}
+	writer.ResponseWriter.WriteHeader(status)
+}
+
+func (writer *responseWriter) Write(data []byte) (int, error) {
+	if writer.status == 0 {
+		writer.status = http.StatusOK
+	}
+	size, err := writer.ResponseWriter.Write(data)
+	writer.size += size
+	return size, err
+}
+
+// WebSocket などのために接続を乗っ取る．乗っ取った後のステータスコードは 101 として記録する．
+//
+// 接続を直接読み込む websocket パッケージは http.Hijacker を型アサーションで求めるため，明示的に実装する．
+func (writer *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, buffer, err := http.NewResponseController(writer.ResponseWriter).Hijack()
+	if err == nil && writer.status == 0 {
+		writer.status = http.StatusSwitchingProtocols
+	}
+	return conn, buffer, err
+}
+
+// http.ResponseController が元の http.ResponseWriter の機能を使えるようにする．
+func (writer *responseWriter) Unwrap() http.ResponseWriter {
+	return writer.ResponseWriter
+}
+
+// JSON 形式で出力する1件のリクエストログ．
+//
+// RequestID は，requestIDMiddleware が決めたリクエスト ID．
+// RemoteAddr と UserAgent は，LogLevel が "debug" の場合のみ記録する．
+type requestLogEntry struct {
+	Time       time.Time `json:"time"`
+	RequestID  string    `json:"requestId,omitempty"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Status     int       `json:"status"`
+	Size       int       `json:"size"`
+	DurationMs float64   `json:"durationMs"`
+
+	RemoteAddr string `json:"remoteAddr,omitempty"`
+	UserAgent  string `json:"userAgent,omitempty"`
+}
+
+// JSON 形式のリクエストログの出力先．各行を JSON として読めるよう，日時の接頭辞は付けない．
+var jsonRequestLogger = log.New(os.Stderr, "", 0)
+
+// 全てのリクエストについて，メソッド，パス，ステータスコード，レスポンスの大きさ，処理時間をログに記録するミドルウェア．
+//
+// format には logFormatText か logFormatJSON を指定する．
+// ログの重要度は info とし，LogLevel が "debug" の場合は送信元のアドレスと User-Agent も記録する．
+// リクエスト ID がある場合は，それも記録する．
+func logRequests(next http.Handler, format string) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+		recorder := &responseWriter{ResponseWriter: writer}
+		next.ServeHTTP(recorder, request)
+		duration := time.Since(start)
+
+		// 何も書き込まれなかった場合は，net/http と同じく 200 とみなす．
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		if !logEnabled(logLevelInfo) {
+			return
+		}
+		detailed := logEnabled(logLevelDebug)
+
+		if format == logFormatJSON {
+			entry := requestLogEntry{
+				Time:       start,
+				RequestID:  requestIDFromContext(request.Context()),
+				Method:     request.Method,
+				Path:       request.URL.Path,
+				Status:     status,
+				Size:       recorder.size,
+				DurationMs: float64(duration.Microseconds()) / 1000,
+			}
+			if detailed {
+				entry.RemoteAddr = request.RemoteAddr
+				entry.UserAgent = request.UserAgent()
+			}
+			line, err := json.Marshal(entry)
+			if err != nil {
+				logError("Cannot encode request log", err)
+				return
+			}
+			jsonRequestLogger.Println(string(line))
+			return
+		}
+		prefix := requestLogPrefix(request.Context())
+		if detailed {
+			logInfof("%s%s %s %d %dB %s from %s %q", prefix, request.Method, request.URL.Path, status, recorder.size, duration, request.RemoteAddr, request.UserAgent())
+			return
+		}
+		logInfof("%s%s %s %d %dB %s", prefix, request.Method, request.URL.Path, status, recorder.size, duration)
+	})
+}
+
+// リクエストボディを最大 maxBytes バイトまでしか読み込めないようにするミドルウェア．
+//
+// 巨大なボディでメモリを使い果たされないよう，全てのハンドラより前で制限する．
+// 制限を超えて読み込もうとすると *http.MaxBytesError が返るため，ハンドラはそれを 413 として扱うこと．
+func limitRequestBody(next http.Handler, maxBytes int64) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		request.Body = http.MaxBytesReader(writer, request.Body, maxBytes)
+		next.ServeHTTP(writer, request)
+	})
+}
+
+// 後続のハンドラで発生したパニックから回復し，スタックトレースを記録して 500 を返すミドルウェア．
+//
+// JSON API へのリクエストには JSON で，それ以外には平文でエラーを返す．
+// ミドルウェアのパニックからも回復できるよう最も外側に置くため，リクエスト ID はレスポンスのヘッダから読み取って記録する．
+// 接続の中断を表す http.ErrAbortHandler は，net/http に処理を任せるため回復しない．
+func recoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			// 内側の requestIDMiddleware が決めたリクエスト ID を，レスポンスのヘッダから引き継いで記録する．
+			request = requestWithResponseID(writer, request)
+			logRequestErrorf(request, "Recovered from panic in %s %s: %v\n%s", request.Method, request.URL.Path, recovered, debug.Stack())
+			if strings.HasPrefix(request.URL.Path, apiPathPrefix) {
+				writeError(writer, http.StatusInternalServerError, "internal server error")
+				return
+			}
+			http.Error(writer, "Internal Server Error", http.StatusInternalServerError)
+		}()
+
+		next.ServeHTTP(writer, request)
+	})
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// ハンドラがパニックを起こしたリクエストに 500 を返し，その後もサーバが他のリクエストを処理し続けることを確認する．
+func TestRecoverMiddleware(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(apiPathPrefix+"panic", func(http.ResponseWriter, *http.Request) {
+		panic("test panic")
+	})
+	mux.HandleFunc("/panic", func(http.ResponseWriter, *http.Request) {
+		panic("test panic")
+	})
+	mux.HandleFunc("/ok", func(writer http.ResponseWriter, _ *http.Request) {
+		writer.WriteHeader(http.StatusNoContent)
+	})
+	server := httptest.NewServer(recoverMiddleware(requestIDMiddleware(mux)))
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		path            string
+		wantStatus      int
+		wantContentType string
+	}{
+		{path: apiPathPrefix + "panic", wantStatus: http.StatusInternalServerError, wantContentType: "application/json"},
+		{path: "/panic", wantStatus: http.StatusInternalServerError, wantContentType: "text/plain; charset=utf-8"},
+		{path: "/ok", wantStatus: http.StatusNoContent},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			response, err := http.Get(server.URL + test.path)
+			if err != nil {
+				t.Fatalf("GET %s: %v", test.path, err)
+			}
+			response.Body.Close()
+			if response.StatusCode != test.wantStatus {
+				t.Errorf("status = %d, want %d", response.StatusCode, test.wantStatus)
+			}
+			if got := response.Header.Get("Content-Type"); test.wantContentType != "" && got != test.wantContentType {
+				t.Errorf("Content-Type = %q, want %q", got, test.wantContentType)
+			}
+		})
+	}
+}
+
+// 妥当な X-Request-ID ヘッダの値はそのまま用い，無い場合や不正な場合は新しい ID を発行してレスポンスに付けることを確認する．
+func TestRequestIDMiddleware(t *testing.T) {
+	var seen string
+	handler := requestIDMiddleware(http.HandlerFunc(func(_ http.ResponseWriter, request *http.Request) {
+		seen = requestIDFromContext(request.Context())
+	}))
+
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{name: "valid", header: "abc-123.x_y", want: "abc-123.x_y"},
+		{name: "missing"},
+		{name: "with a newline", header: "abc\ninjected"},
+		{name: "too long", header: strings.Repeat("a", 65)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			if test.header != "" {
+				request.Header.Set(requestIDHeader, test.header)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			got := recorder.Header().Get(requestIDHeader)
+			if got != seen {
+				t.Errorf("response ID %q differs from context ID %q", got, seen)
+			}
+			if test.want != "" && got != test.want {
+				t.Errorf("ID = %q, want %q", got, test.want)
+			}
+			if test.want == "" && (len(got) != 2*requestIDBytes || got == test.header) {
+				t.Errorf("ID = %q, want a new %d-byte hex ID", got, requestIDBytes)
+			}
+		})
+	}
+}
+
+// 別の送信元からの事前確認で X-Request-ID ヘッダの送信を許可し，レスポンスの X-Request-ID ヘッダを読めるようにすることを確認する．
+func TestCORSRequestIDHeader(t *testing.T) {
+	handler := corsMiddleware(http.HandlerFunc(func(writer http.ResponseWriter, _ *http.Request) {
+		writer.WriteHeader(http.StatusNoContent)
+	}), []string{"https://example.com"})
+
+	preflight := httptest.NewRequest(http.MethodOptions, apiPathPrefix+"flip", nil)
+	preflight.Header.Set("Origin", "https://example.com")
+	preflight.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	preflight.Header.Set("Access-Control-Request-Headers", "content-type, x-request-id")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, preflight)
+	if got := recorder.Header().Get("Access-Control-Allow-Headers"); !strings.Contains(got, requestIDHeader) {
+		t.Errorf("Access-Control-Allow-Headers = %q, want it to include %s", got, requestIDHeader)
+	}
+
+	request := httptest.NewRequest(http.MethodPost, apiPathPrefix+"flip", nil)
+	request.Header.Set("Origin", "https://example.com")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if got := recorder.Header().Get("Access-Control-Expose-Headers"); got != requestIDHeader {
+		t.Errorf("Access-Control-Expose-Headers = %q, want %q", got, requestIDHeader)
+	}
+}
+
+// 最も外側の recoverMiddleware が，パニックのログに内側で決めたリクエスト ID を含めることを確認する．
+func TestRecoverMiddlewareLogsRequestID(t *testing.T) {
+	var output bytes.Buffer
+	previous := log.Writer()
+	log.SetOutput(&output)
+	t.Cleanup(func() { log.SetOutput(previous) })
+
+	handler := recoverMiddleware(requestIDMiddleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("test panic")
+	})))
+	request := httptest.NewRequest(http.MethodGet, "/x", nil)
+	request.Header.Set(requestIDHeader, "myid123")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", recorder.Code, http.StatusInternalServerError)
+	}
+	if line := output.String(); !strings.Contains(line, "[myid123] Recovered from panic in GET /x") {
+		t.Errorf("log = %q, want the panic logged with the request ID", line)
+	}
+}
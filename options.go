@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+)
+
+// GET /api/options で返す1つの難易度．
+//
+// Pairs は，その難易度の盤面の絵柄の組数．
+type difficultyOption struct {
+	Difficulty
+	Pairs int `json:"pairs"`
+}
+
+// GET /api/options で返す1つのテーマ．
+//
+// Images は，そのテーマに含まれる画像の数．盤面の組数はこれを超えられない．
+type themeOption struct {
+	Name   string `json:"name"`
+	Images int    `json:"images"`
+}
+
+// GET /api/options のレスポンスの形式．
+//
+// MaxPairs は，クエリパラメータ pairs に指定できる組数の上限．
+type optionsResponse struct {
+	Difficulties []difficultyOption `json:"difficulties"`
+	Themes       []themeOption      `json:"themes"`
+	MaxPairs     int                `json:"maxPairs"`
+}
+
+// GET /api/options を処理し，選べる難易度とテーマの一覧を JSON として返す．
+//
+// テーマは画像を読み込み直すと変わるため，ブラウザには毎回確認させた上で，一覧の内容から作った ETag が
+// If-None-Match ヘッダと一致する場合は 304 を返す．
+func (app *application) optionsHandler(writer http.ResponseWriter, request *http.Request) {
+	if !requireMethod(writer, request, http.MethodGet) {
+		return
+	}
+
+	response := optionsResponse{MaxPairs: maxPairs}
+	for _, difficulty := range difficulties {
+		response.Difficulties = append(response.Difficulties, difficultyOption{
+			Difficulty: difficulty,
+			Pairs:      difficulty.Rows * difficulty.Cols / 2,
+		})
+	}
+	themes := app.currentThemes()
+	for _, name := range themes.names() {
+		response.Themes = append(response.Themes, themeOption{Name: name, Images: len(themes[name])})
+	}
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		logRequestError(request, "Cannot encode options", err)
+		writeError(writer, http.StatusInternalServerError, "cannot encode options")
+		return
+	}
+	hash := fnv.New64a()
+	hash.Write(data)
+	etag := fmt.Sprintf(`"%x"`, hash.Sum64())
+
+	writer.Header().Set("ETag", etag)
+	writer.Header().Set("Cache-Control", "no-cache")
+	if etagMatches(request.Header.Get("If-None-Match"), etag) {
+		writer.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeJSON(writer, http.StatusOK, response)
+}
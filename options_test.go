@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// GET /api/options が毎回確認させるキャッシュのヘッダを付け，一覧が変わらなければ 304 を，画像を読み込み直してテーマが変わった後は新しい ETag で 200 を返すことを確認する．
+func TestOptionsCaching(t *testing.T) {
+	config := newTestConfig(t)
+	config.ImageDir = newTestImageDir(t, map[string]int{"": defaultPairs})
+	config.AdminToken = "secret"
+	server := newTestServer(t, config)
+	client := server.newClient()
+
+	response := server.do(client, http.MethodGet, "/api/options", nil)
+	etag := response.Header.Get("ETag")
+	if response.StatusCode != http.StatusOK || etag == "" || response.Header.Get("Cache-Control") != "no-cache" {
+		t.Fatalf("status %d, ETag %q, Cache-Control %q, want 200 with an ETag and no-cache", response.StatusCode, etag, response.Header.Get("Cache-Control"))
+	}
+	response = server.do(client, http.MethodGet, "/api/options", nil, "If-None-Match", etag)
+	if response.StatusCode != http.StatusNotModified {
+		t.Errorf("unchanged options: status %d, want %d", response.StatusCode, http.StatusNotModified)
+	}
+
+	// テーマを加えて画像を読み込み直す．
+	animals := filepath.Join(config.ImageDir, "animals")
+	err := os.Mkdir(animals, 0o755)
+	if err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+	source := filepath.Join(config.ImageDir, "00.png")
+	for _, name := range []string{"00.png", "01.png"} {
+		data, err := os.ReadFile(source)
+		if err == nil {
+			err = os.WriteFile(filepath.Join(animals, name), data, 0o644)
+		}
+		if err != nil {
+			t.Fatalf("copying image: %v", err)
+		}
+	}
+	response = server.do(client, http.MethodPost, "/admin/reload", nil, "Authorization", "Bearer "+config.AdminToken)
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("POST /admin/reload: status %d: %s", response.StatusCode, readBody(t, response))
+	}
+
+	response = server.do(client, http.MethodGet, "/api/options", nil, "If-None-Match", etag)
+	if response.StatusCode != http.StatusOK || response.Header.Get("ETag") == etag {
+		t.Errorf("after reloading: status %d, ETag %q, want 200 with a new ETag", response.StatusCode, response.Header.Get("ETag"))
+	}
+}
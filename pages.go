@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// ハンドラが描画する，テンプレートファイルに定義されていなければならないテンプレートの名前．
+var requiredTemplates = []string{"head", "footer", "title", "display", "error", "notFound"}
+
+// dir 直下の全てのテンプレートファイルを読み込み，1つのテンプレートの集合として戻り値として返す．
+//
+// 各ページのテンプレートは，layout.html に定義された共通のヘッダとフッタを用いる．
+// テンプレートからは，パスに BasePath を付ける urlFor 関数を使える．
+// requiredTemplates のいずれかが定義されていない場合は，最初のリクエストを待たずにエラーを返す．
+func loadTemplates(dir string, config *Configuration) (*template.Template, error) {
+	funcs := template.FuncMap{"urlFor": config.urlFor}
+	templates, err := template.New(filepath.Base(dir)).Funcs(funcs).ParseGlob(filepath.Join(dir, "*.html"))
+	if err != nil {
+		return nil, err
+	}
+
+	missing := []string{}
+	for _, name := range requiredTemplates {
+		if templates.Lookup(name) == nil {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("templates %s are not defined", strings.Join(missing, ", "))
+	}
+
+	return templates, nil
+}
+
+// 読み込み済みのテンプレートのうち，指定された名前のテンプレートに data を適用した結果をレスポンスとして書き込む．
+//
+// 適用に失敗した場合は，エラーをログに記録して 500 を返す．
+// 途中まで描画されたページが送られないよう，適用結果は一度バッファに書き込んでから送る．
+// ページは Accept-Language ヘッダに応じた言語で描画されるため，キャッシュがそれを区別できるよう Vary ヘッダを付ける．
+func (app *application) renderTemplate(writer http.ResponseWriter, status int, name string, data any) {
+	var buffer bytes.Buffer
+	err := app.templates.ExecuteTemplate(&buffer, name, data)
+	if err != nil {
+		logError("Cannot execute template", name, err)
+		http.Error(writer, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	writer.Header().Add("Vary", "Accept-Language")
+	writer.WriteHeader(status)
+	buffer.WriteTo(writer)
+}
+
+// エラー画面のテンプレートに渡すデータをまとめた構造体．
+//
+// Status は，HTTP のステータスコード．
+// Message は，画面に表示する説明．
+type ErrorView struct {
+	PageText
+	Status  int
+	Message string
+}
+
+// 文言の一覧のキー messageKey に対応する説明を載せたエラー画面を，status と共にレスポンスとして書き込む．
+func (app *application) renderError(writer http.ResponseWriter, request *http.Request, status int, messageKey string) {
+	text := pageTextFor(request)
+	view := ErrorView{
+		PageText: text,
+		Status:   status,
+		Message:  text.Messages[messageKey],
+	}
+	app.renderTemplate(writer, status, "error", view)
+}
+
+// タイトル画面のテンプレートに渡すデータをまとめた構造体．
+//
+// HighScoreCount は，これまでに記録されたハイスコアの件数．
+type TitleView struct {
+	PageText
+	HighScoreCount int
+}
+
+// GET / を処理し，これまでに記録されたハイスコアの件数を載せたタイトル画面を返す．
+//
+// ハイスコアを読み出せない場合は，500 のエラーページを返す．
+func (app *application) processTitle(writer http.ResponseWriter, request *http.Request) {
+	count, err := app.leaderboard.Len()
+	if err != nil {
+		logRequestError(request, "Cannot read scores", err)
+		app.renderError(writer, request, http.StatusInternalServerError, "scoresUnavailable")
+		return
+	}
+	view := TitleView{
+		PageText:       pageTextFor(request),
+		HighScoreCount: count,
+	}
+	app.renderTemplate(writer, http.StatusOK, "title", view)
+}
+
+// 404 のページのテンプレートに渡すデータをまとめた構造体．
+//
+// Path は，リクエストされたパス．
+type NotFoundView struct {
+	PageText
+	Path string
+}
+
+// 登録されていないパスへのリクエストに対し，タイトル画面へのリンクを載せたページを 404 と共に返す．
+func (app *application) notFoundHandler(writer http.ResponseWriter, request *http.Request) {
+	view := NotFoundView{
+		PageText: pageTextFor(request),
+		Path:     request.URL.Path,
+	}
+	app.renderTemplate(writer, http.StatusNotFound, "notFound", view)
+}
+
+// ゲーム画面のテンプレートに渡すデータをまとめた構造体．
+//
+// PlayerName は，セッションのプレイヤーが名乗った名前．まだ名乗っていなければ，表示する言語の名無しの名前．
+// Difficulty は，盤面の大きさに対応する難易度の名前．どの難易度にも当てはまらなければ customDifficulty．
+// Rows と Cols は，セッションのゲームの盤面の行数と列数．
+// Token は，セッションのゲームのトークン．
+type GameView struct {
+	PageText
+	PlayerName string
+	Difficulty string
+	Rows       int
+	Cols       int
+	Token      string
+}
+
+// どの難易度にも当てはまらない大きさの盤面の難易度として表示する名前．
+const customDifficulty = "custom"
+
+// セッションのゲームの盤面と，プレイヤーの名前を載せたゲーム画面を返す．
+//
+// セッションにまだゲームが無い場合は，既定の組数の盤面でゲームを始める．
+func (app *application) processGame(writer http.ResponseWriter, request *http.Request) {
+	id := sessionIDFromContext(request.Context())
+	text := pageTextFor(request)
+	view := GameView{
+		PageText:   text,
+		PlayerName: text.Messages["anonymousName"],
+		Difficulty: customDifficulty,
+	}
+
+	theme := app.sessionTheme(id)
+	createGame := func() (*Game, error) {
+		rows, cols := gridForPairs(defaultPairs)
+		return app.startGame(theme, rows, cols, BoardOptions{})
+	}
+	err := app.sessions.update(id, createGame, func(game *Game) {
+		view.Rows = game.Board.Rows
+		view.Cols = game.Board.Cols
+		view.Token = game.Token
+	})
+	if errors.Is(err, errTooManyGames) {
+		app.renderError(writer, request, http.StatusServiceUnavailable, "tooManyGames")
+		return
+	}
+	if err != nil {
+		logRequestError(request, "Cannot start game", err)
+		app.renderError(writer, request, http.StatusInternalServerError, "gameUnavailable")
+		return
+	}
+
+	if name := app.sessions.playerName(id); name != "" {
+		view.PlayerName = name
+	}
+	if difficulty, ok := difficultyForGrid(view.Rows, view.Cols); ok {
+		view.Difficulty = difficulty
+	}
+	app.renderTemplate(writer, http.StatusOK, "display", view)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// プレイヤーの名前に含まれる HTML が，ゲームのページでエスケープされて表示されることを確認する．
+func TestProcessGameEscapesPlayerName(t *testing.T) {
+	server := newTestServer(t, newTestConfig(t))
+	client := server.newClient()
+
+	name := "<script>x</script>"
+	response := server.do(client, http.MethodPost, "/api/flip", flipRequest{Card: 0, Name: name})
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("POST /api/flip: status %d: %s", response.StatusCode, readBody(t, response))
+	}
+
+	body := readBody(t, server.do(client, http.MethodGet, "/game", nil))
+	if strings.Contains(body, name) {
+		t.Errorf("page contains the unescaped name %q", name)
+	}
+	if want := "&lt;script&gt;x&lt;/script&gt;"; !strings.Contains(body, want) {
+		t.Errorf("page does not contain the escaped name %q", want)
+	}
+}
+
+// 存在しないパスに，notFound のテンプレートで作ったページと共に 404 を返すことを確認する．
+func TestNotFoundPage(t *testing.T) {
+	server := newTestServer(t, newTestConfig(t))
+
+	response := server.do(server.newClient(), http.MethodGet, "/nonsense", nil, "Accept-Language", "en")
+	if response.StatusCode != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d", response.StatusCode, http.StatusNotFound)
+	}
+	if got := response.Header.Get("Content-Type"); !strings.HasPrefix(got, "text/html") {
+		t.Errorf("Content-Type = %q, want text/html", got)
+	}
+	body := readBody(t, response)
+	for _, want := range []string{"<title>Page not found</title>", "There is no page at /nonsense."} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body does not contain %q", want)
+		}
+	}
+}
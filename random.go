@@ -0,0 +1,28 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// 複数のリクエストから共有する，盤面の並べ替えやヒントに用いる乱数の生成元．
+//
+// *rand.Rand は並行に使えないため，mutex で保護した生成元から1つのリクエストごとに生成器を作る．
+// 同じ種で作った生成元からは，同じ順に要求する限り常に同じ乱数の列が得られる．
+type randomSource struct {
+	mutex  sync.Mutex
+	random *rand.Rand
+}
+
+// 乱数の種を受け取り，乱数の生成元を戻り値として返す．
+func newRandomSource(seed int64) *randomSource {
+	return &randomSource{random: rand.New(rand.NewSource(seed))}
+}
+
+// 生成元から種を取り出し，1つのリクエストの中だけで用いる乱数の生成器を戻り値として返す．
+func (source *randomSource) child() *rand.Rand {
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+
+	return rand.New(rand.NewSource(source.random.Int63()))
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// 一定の速さで回復するトークンを消費して，操作の頻度を制限するトークンバケット．
+//
+// ゼロ値は，トークンが満杯の状態として扱う．
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// 1秒あたり rate 個，最大 burst 個まで回復するトークンを1つ消費できるか判定して消費する．
+//
+// 消費できた場合は true を返す．消費できなかった場合は false と，次のトークンが回復するまでの時間を返す．
+func (bucket *tokenBucket) take(rate float64, burst float64, now time.Time) (bool, time.Duration) {
+	if bucket.last.IsZero() {
+		bucket.tokens = burst
+	} else {
+		elapsed := now.Sub(bucket.last).Seconds()
+		bucket.tokens = math.Min(burst, bucket.tokens+elapsed*rate)
+	}
+	bucket.last = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+	wait := (1 - bucket.tokens) / rate
+	return false, time.Duration(wait * float64(time.Second))
+}
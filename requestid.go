@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+)
+
+// リクエスト ID を受け渡す HTTP ヘッダの名前．
+const requestIDHeader = "X-Request-ID"
+
+// リクエスト ID に用いる乱数のバイト数．ログで見分けられればよいため，セッション ID より短くする．
+const requestIDBytes = 8
+
+// クライアントから送られたリクエスト ID として受け入れる文字列の規則．
+//
+// ログの行を偽装されないよう，改行や空白を含むものは受け入れない．
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// リクエスト ID に用いるランダムな文字列を戻り値として返す．
+func newRequestID() (string, error) {
+	buffer := make([]byte, requestIDBytes)
+	_, err := rand.Read(buffer)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buffer), nil
+}
+
+// リクエストのコンテキストにリクエスト ID を格納する際のキーの型．
+type requestIDContextKey struct{}
+
+// リクエストのコンテキストからリクエスト ID を取り出して戻り値として返す．
+//
+// requestIDMiddleware を通ったリクエストでなければ空文字列を返す．
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// requestIDMiddleware がレスポンスのヘッダに付けたリクエスト ID を，コンテキストに格納したリクエストを戻り値として返す．
+//
+// requestIDMiddleware の外側のミドルウェアが，ID を含めてログに記録するために用いる．
+// コンテキストに既に ID がある場合や，レスポンスに ID が無い場合は request をそのまま返す．
+func requestWithResponseID(writer http.ResponseWriter, request *http.Request) *http.Request {
+	id := writer.Header().Get(requestIDHeader)
+	if id == "" || requestIDFromContext(request.Context()) != "" {
+		return request
+	}
+	return request.WithContext(context.WithValue(request.Context(), requestIDContextKey{}, id))
+}
+
+// リクエストごとにリクエスト ID を決めてコンテキストに格納し，X-Request-ID ヘッダとしてレスポンスにも付けるミドルウェア．
+//
+// リクエストに妥当な X-Request-ID ヘッダがあればその値を用い，無ければランダムな ID を発行する．ID を発行できない場合は 500 を返す．
+// 後続のミドルウェアのログにも ID を含められるよう，ミドルウェアのパニックからも回復する recoverMiddleware の次に外側に置くこと．
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		id := request.Header.Get(requestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			var err error
+			id, err = newRequestID()
+			if err != nil {
+				logError("Cannot issue request ID", err)
+				http.Error(writer, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		writer.Header().Set(requestIDHeader, id)
+		ctx := context.WithValue(request.Context(), requestIDContextKey{}, id)
+		next.ServeHTTP(writer, request.WithContext(ctx))
+	})
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// 成績の画像を保持しておくゲームの数．これを超えた場合は古いものから捨てる．
+const maxResultImages = 256
+
+// ResultFontFile のフォントで成績の画像に文字を書く大きさのポイント数．
+const resultFontSize = 32
+
+// 組み込みのフォントで書いた成績の画像を拡大する倍率．
+const resultFallbackScale = 3
+
+// 成績の画像の余白と，文字の周りの枠線の太さのピクセル数．拡大する前の大きさで表す．
+const (
+	resultPadding = 12
+	resultBorder  = 2
+)
+
+// 成績の画像のフォントで求められた言語の文言を書けない場合に用いる言語．組み込みのフォントでも書ける英語とする．
+const resultFallbackLang = "en"
+
+// 成績の画像に書く文言のキー．
+var resultMessageKeys = []string{"gameName", "resultPlayer", "resultMoves", "resultTime", "resultScore", "anonymousName"}
+
+// 成績の画像の色．ページの背景色と枠線の色に合わせる．
+var (
+	resultBackground = color.RGBA{0xe2, 0xff, 0xc6, 0xff}
+	resultForeground = color.RGBA{0x00, 0x00, 0x00, 0xff}
+)
+
+// 成績の画像に書く，終えたゲームの結果．
+type gameResult struct {
+	PlayerName string
+	Score      Score
+	FinishedAt time.Time
+}
+
+// 成績の画像に文字を書くフォント．
+//
+// scale は，書いた画像を拡大する倍率．小さな組み込みのフォントでも読める大きさにするために用いる．
+type resultFont struct {
+	face  font.Face
+	scale int
+}
+
+// path のフォントファイルを読み出し，成績の画像に用いるフォントを戻り値として返す．
+//
+// path が空の場合や読み出せない場合は，英数字のみを書ける組み込みのフォントを返す．
+func loadResultFont(path string) resultFont {
+	fallback := resultFont{face: basicfont.Face7x13, scale: resultFallbackScale}
+	if path == "" {
+		return fallback
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		logError("Cannot read result font, using the built-in font", err)
+		return fallback
+	}
+	parsed, err := opentype.Parse(data)
+	if err != nil {
+		logError("Cannot parse result font", path, "- using the built-in font", err)
+		return fallback
+	}
+	face, err := opentype.NewFace(parsed, &opentype.FaceOptions{Size: resultFontSize, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		logError("Cannot load result font", path, "- using the built-in font", err)
+		return fallback
+	}
+	return resultFont{face: face, scale: 1}
+}
+
+// 成績の画像を区別するキー．同じゲームの画像も，言語ごとに別々に作成する．
+type resultKey struct {
+	token string
+	lang  string
+}
+
+// ゲームのトークンと言語ごとに，作成済みの成績の画像を PNG として保持する構造体．
+//
+// font の face は並行に使えないため，画像の作成中も mutex を獲得したままとする．
+// order は，images に加えた順のキーの一覧．
+type resultCache struct {
+	mutex  sync.Mutex
+	font   resultFont
+	images map[resultKey][]byte
+	order  []resultKey
+}
+
+func newResultCache(fontFile string) *resultCache {
+	return &resultCache{font: loadResultFont(fontFile), images: map[resultKey][]byte{}}
+}
+
+// 言語の名前を受け取り，成績の画像に用いる言語の名前を戻り値として返す．
+//
+// フォントがその言語の文言を書けない場合は，resultFallbackLang を返す．組み込みのフォントでは日本語を書けないため，英語になる．
+func (cache *resultCache) langFor(lang string) string {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	messages := messagesFor(lang)
+	for _, key := range resultMessageKeys {
+		if drawableText(cache.font.face, messages[key]) != messages[key] {
+			return resultFallbackLang
+		}
+	}
+	return lang
+}
+
+// トークンが token のゲームの，lang の言語で書いた成績の画像を戻り値として返す．
+//
+// 作成済みでなければ result から作成し，以降の呼び出しのために保持する．
+func (cache *resultCache) get(token string, lang string, result gameResult) ([]byte, error) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	key := resultKey{token: token, lang: lang}
+	if cached, ok := cache.images[key]; ok {
+		return cached, nil
+	}
+	rendered, err := renderResult(cache.font, resultLines(messagesFor(lang), result))
+	if err != nil {
+		return nil, err
+	}
+
+	cache.images[key] = rendered
+	cache.order = append(cache.order, key)
+	if len(cache.order) > maxResultImages {
+		delete(cache.images, cache.order[0])
+		cache.order = cache.order[1:]
+	}
+
+	return rendered, nil
+}
+
+// フォントで書けない文字を "?" に置き換えた text を戻り値として返す．
+func drawableText(face font.Face, text string) string {
+	return strings.Map(func(r rune) rune {
+		if _, ok := face.GlyphAdvance(r); !ok {
+			return '?'
+		}
+		return r
+	}, text)
+}
+
+// 文言の一覧とゲームの結果を受け取り，成績の画像に書くゲームの名前，プレイヤーの名前，めくった回数，かかった時間，得点の行を戻り値として返す．
+//
+// プレイヤーが名乗っていない場合は，その言語の名無しの名前を書く．
+func resultLines(messages map[string]string, result gameResult) []string {
+	name := result.PlayerName
+	if name == "" {
+		name = messages["anonymousName"]
+	}
+	duration := time.Duration(result.Score.DurationSeconds * float64(time.Second)).Round(time.Second)
+	return []string{
+		messages["gameName"],
+		fmt.Sprintf(messages["resultPlayer"], name),
+		fmt.Sprintf(messages["resultMoves"], result.Score.Moves),
+		fmt.Sprintf(messages["resultTime"], duration),
+		fmt.Sprintf(messages["resultScore"], result.Score.Points),
+	}
+}
+
+// 書く行の一覧を受け取り，それらを書いた画像を PNG として戻り値として返す．
+func renderResult(resultFont resultFont, lines []string) ([]byte, error) {
+	face := resultFont.face
+
+	// 最も長い行が収まるように画像の大きさを決める．
+	metrics := face.Metrics()
+	lineHeight := metrics.Height.Ceil()
+	textWidth := 0
+	for i, line := range lines {
+		lines[i] = drawableText(face, line)
+		textWidth = max(textWidth, font.MeasureString(face, lines[i]).Ceil())
+	}
+	inset := resultBorder + resultPadding
+	canvas := image.NewRGBA(image.Rect(0, 0, textWidth+2*inset, lineHeight*len(lines)+2*inset))
+
+	// 枠線を引き，その内側を背景色で塗ってから文字を書く．
+	draw.Draw(canvas, canvas.Bounds(), image.NewUniform(resultForeground), image.Point{}, draw.Src)
+	inner := canvas.Bounds().Inset(resultBorder)
+	draw.Draw(canvas, inner, image.NewUniform(resultBackground), image.Point{}, draw.Src)
+	drawer := &font.Drawer{Dst: canvas, Src: image.NewUniform(resultForeground), Face: face}
+	for i, line := range lines {
+		drawer.Dot = fixed.P(inset, inset+i*lineHeight+metrics.Ascent.Ceil())
+		drawer.DrawString(line)
+	}
+
+	var output image.Image = canvas
+	if resultFont.scale > 1 {
+		bounds := canvas.Bounds()
+		scaled := image.NewRGBA(image.Rect(0, 0, bounds.Dx()*resultFont.scale, bounds.Dy()*resultFont.scale))
+		draw.NearestNeighbor.Scale(scaled, scaled.Bounds(), canvas, bounds, draw.Src, nil)
+		output = scaled
+	}
+
+	var buffer bytes.Buffer
+	err := png.Encode(&buffer, output)
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// GET /api/game/{id}/result.png を処理し，トークンが id のゲームの成績を書いた共有用の画像を PNG として返す．
+//
+// 画像は全ての組を揃えた後に限り返す．そのようなゲームが無い場合は 404 を，ゲームを終えていない場合は 409 を返す．
+// 文言は Accept-Language ヘッダに応じた言語で書くが，フォントがその言語を書けない場合は英語で書く．
+func (app *application) resultImageHandler(writer http.ResponseWriter, request *http.Request) {
+	if !requireMethod(writer, request, http.MethodGet) {
+		return
+	}
+
+	token := request.PathValue("id")
+	var result gameResult
+	complete := false
+	found := app.sessions.lookupToken(token, func(game *Game) {
+		complete = game.IsComplete()
+		if complete {
+			result.Score = game.FinalScore()
+			result.FinishedAt = game.FinishedAt
+		}
+	})
+
+	switch {
+	case !found:
+		writeError(writer, http.StatusNotFound, "no game with this id")
+		return
+	case !complete:
+		writeError(writer, http.StatusConflict, "result image is available once the game is complete")
+		return
+	}
+
+	result.PlayerName = app.sessions.playerNameForToken(token)
+	lang := app.results.langFor(langFromRequest(request))
+	rendered, err := app.results.get(token, lang, result)
+	if err != nil {
+		logRequestError(request, "Cannot render result image", err)
+		writeError(writer, http.StatusInternalServerError, "cannot render result image")
+		return
+	}
+
+	writer.Header().Add("Vary", "Accept-Language")
+	writer.Header().Set("Content-Type", "image/png")
+	http.ServeContent(writer, request, "", result.FinishedAt, bytes.NewReader(rendered))
+}
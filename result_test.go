@@ -0,0 +1,59 @@
+package main
+
+import (
+	"image/png"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+// 成績の画像の行が言語ごとの文言で書かれ，名乗っていないプレイヤーにはその言語の名無しの名前を用いることを確認する．
+func TestResultLines(t *testing.T) {
+	score := Score{Moves: 8, DurationSeconds: 61.4, Points: 1234}
+	tests := []struct {
+		lang string
+		name string
+		want []string
+	}{
+		{lang: "ja", want: []string{"絵合わせゲーム", "プレイヤー: 名無し", "手数: 8", "時間: 1m1s", "得点: 1234"}},
+		{lang: "en", want: []string{"Picture Matching", "Player: Anonymous", "Moves: 8", "Time: 1m1s", "Score: 1234"}},
+		{lang: "en", name: "alice", want: []string{"Picture Matching", "Player: alice", "Moves: 8", "Time: 1m1s", "Score: 1234"}},
+	}
+	for _, test := range tests {
+		got := resultLines(messagesFor(test.lang), gameResult{PlayerName: test.name, Score: score})
+		if !slices.Equal(got, test.want) {
+			t.Errorf("%s, %q: lines = %q, want %q", test.lang, test.name, got, test.want)
+		}
+	}
+}
+
+// 日本語を書けない組み込みのフォントでは，日本語を求められても英語の文言で成績の画像を書くことを確認する．
+func TestResultImageFallbackLang(t *testing.T) {
+	cache := newResultCache("")
+	for _, lang := range []string{"ja", "en"} {
+		if got := cache.langFor(lang); got != "en" {
+			t.Errorf("langFor(%q) = %q with the built-in font, want %q", lang, got, "en")
+		}
+	}
+
+	server := newTestServer(t, newTestConfig(t))
+	client := server.newClient()
+	var created newGameResponse
+	decodeBody(t, server.do(client, http.MethodPost, "/api/new?pairs=2", nil), &created)
+	var board *Board
+	server.app.sessions.lookupToken(created.Token, func(game *Game) {
+		board = game.Board
+	})
+	for _, move := range board.Solve() {
+		server.do(client, http.MethodPost, "/api/flip", flipRequest{Card: move.CardIndex})
+	}
+
+	response := server.do(client, http.MethodGet, "/api/game/"+created.Token+"/result.png", nil, "Accept-Language", "ja")
+	if response.StatusCode != http.StatusOK || response.Header.Get("Vary") != "Accept-Language" {
+		t.Fatalf("status %d, Vary %q, want 200 varying by Accept-Language", response.StatusCode, response.Header.Get("Vary"))
+	}
+	_, err := png.Decode(response.Body)
+	if err != nil {
+		t.Errorf("decoding result image: %v", err)
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// 1つの部屋で対戦するプレイヤーの数．
+const roomPlayers = 2
+
+// 部屋の名前に使える文字列の規則．
+var roomNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// 1人のプレイヤーに送るメッセージを溜めておける数．これを超えて受け取れないプレイヤーは切断する．
+const roomSendBuffer = 16
+
+// 部屋が満員で入れないことを表すエラー．
+var errRoomFull = errors.New("room is full")
+
+// 相手の番にカードをめくろうとしたことを表すエラー．
+var errNotYourTurn = errors.New("it is not your turn")
+
+// 相手が揃っておらず，ゲームを一時停止していることを表すエラー．
+var errRoomPaused = errors.New("game is paused until both players are connected")
+
+// 全ての組が揃い，対戦が終わっていることを表すエラー．
+var errRoomFinished = errors.New("game is already finished")
+
+// 部屋に送られたメッセージの種類が不明であることを表すエラー．
+var errUnknownRoomRequest = errors.New("unknown request type")
+
+// プレイヤーから部屋に送られるメッセージの形式．
+//
+// Type は，メッセージの種類．現在は "flip" のみを受け付ける．
+// Card は，"flip" でめくるカードの番号．
+type roomRequest struct {
+	Type string `json:"type"`
+	Card int    `json:"card"`
+}
+
+// プレイヤーから見える対戦の状態．
+//
+// Turn は，カードをめくる番のプレイヤーの番号．
+// Scores は，プレイヤーごとの揃えた組数．
+// Players は，接続しているプレイヤーの数．
+// Paused は，相手が揃っておらず，カードをめくれないかどうか．
+// Finished は，全ての組が揃い，対戦が終わったかどうか．
+type roomStateView struct {
+	gameStateView
+	Turn     int              `json:"turn"`
+	Scores   [roomPlayers]int `json:"scores"`
+	Players  int              `json:"players"`
+	Paused   bool             `json:"paused"`
+	Finished bool             `json:"finished"`
+}
+
+// 部屋からプレイヤーに送るメッセージの形式．
+//
+// Type は，メッセージの種類．"state"，"flip"，"paused"，"error" のいずれか．
+// You は，受け取ったプレイヤー自身の番号．
+// Player と Card は，"flip" でカードをめくったプレイヤーの番号とめくったカードの番号．
+// Matched は，"flip" で絵柄の組が揃ったかどうか．
+// Message は，"paused" や "error" の説明．
+type roomEvent struct {
+	Type    string         `json:"type"`
+	You     int            `json:"you"`
+	Player  *int           `json:"player,omitempty"`
+	Card    *int           `json:"card,omitempty"`
+	Matched bool           `json:"matched,omitempty"`
+	Message string         `json:"message,omitempty"`
+	State   *roomStateView `json:"state,omitempty"`
+}
+
+// 部屋に接続している1人のプレイヤー．
+//
+// send に入れたメッセージは，writeLoop が順に接続へ書き込む．
+type roomClient struct {
+	conn *websocket.Conn
+	send chan roomEvent
+}
+
+// send に入れられたメッセージを，send が閉じられるまで接続へ書き込む．
+//
+// 書き込みに失敗した場合は接続を閉じ，受信側の処理に部屋から抜けさせる．
+func (client *roomClient) writeLoop() {
+	for event := range client.send {
+		err := websocket.JSON.Send(client.conn, event)
+		if err != nil {
+			client.conn.Close()
+		}
+	}
+}
+
+// 2人のプレイヤーが1つの盤面を共有し，交互にカードをめくって対戦する部屋．
+//
+// game は，2人で共有する盤面とその進み具合．
+// players は，番号ごとの接続しているプレイヤー．切断したプレイヤーの番号は nil とする．
+// turn は，カードをめくる番のプレイヤーの番号．2枚めくって揃わなければ相手の番になる．
+// scores は，プレイヤーごとの揃えた組数．
+// 各プレイヤーの接続から同時に操作されるため，全てのフィールドは mutex で保護する．
+type Room struct {
+	mutex   sync.Mutex
+	game    *Game
+	players [roomPlayers]*roomClient
+	turn    int
+	scores  [roomPlayers]int
+}
+
+// 接続しているプレイヤーの数を戻り値として返す．呼び出し側で mutex を獲得しておくこと．
+func (room *Room) connected() int {
+	count := 0
+	for _, client := range room.players {
+		if client != nil {
+			count++
+		}
+	}
+	return count
+}
+
+// プレイヤーから見える対戦の状態を戻り値として返す．呼び出し側で mutex を獲得しておくこと．
+func (room *Room) state() *roomStateView {
+	players := room.connected()
+	return &roomStateView{
+		gameStateView: newGameStateView(room.game),
+		Turn:          room.turn,
+		Scores:        room.scores,
+		Players:       players,
+		Paused:        players < roomPlayers,
+		Finished:      room.game.IsComplete(),
+	}
+}
+
+// プレイヤー index にメッセージを送る．呼び出し側で mutex を獲得しておくこと．
+//
+// 送信待ちのメッセージが溜まりすぎているプレイヤーは，接続を閉じて部屋から抜けさせる．
+func (room *Room) notify(index int, event roomEvent) {
+	client := room.players[index]
+	if client == nil {
+		return
+	}
+	event.You = index
+	select {
+	case client.send <- event:
+	default:
+		logError("Dropping slow player", index, "from room")
+		client.conn.Close()
+	}
+}
+
+// 接続している全てのプレイヤーにメッセージを送る．呼び出し側で mutex を獲得しておくこと．
+func (room *Room) broadcast(event roomEvent) {
+	for index := range room.players {
+		room.notify(index, event)
+	}
+}
+
+// 空いている番号にプレイヤーを加え，その番号を戻り値として返す．
+//
+// 切断したプレイヤーの番号が空いている場合は，そこに入って続きから対戦する．満員の場合は errRoomFull を返す．
+func (room *Room) join(client *roomClient) (int, error) {
+	room.mutex.Lock()
+	defer room.mutex.Unlock()
+
+	index := slices.Index(room.players[:], nil)
+	if index < 0 {
+		return 0, errRoomFull
+	}
+	room.players[index] = client
+	room.broadcast(roomEvent{Type: "state", State: room.state()})
+
+	return index, nil
+}
+
+// プレイヤー index を部屋から除き，部屋が空になったかどうかを戻り値として返す．
+//
+// 相手が残っている場合は，対戦を一時停止したことを知らせる．
+func (room *Room) leave(index int) bool {
+	room.mutex.Lock()
+	defer room.mutex.Unlock()
+
+	close(room.players[index].send)
+	room.players[index] = nil
+	room.broadcast(roomEvent{Type: "paused", Message: "opponent disconnected", State: room.state()})
+
+	return room.connected() == 0
+}
+
+// プレイヤー index が card 番目のカードをめくり，その結果を両方のプレイヤーに知らせる．
+//
+// 相手が揃っていない場合は errRoomPaused を，対戦が終わっている場合は errRoomFinished を，
+// 相手の番の場合は errNotYourTurn を，めくれないカードの場合は Game.Flip のエラーを返す．
+func (room *Room) flip(index int, card int) error {
+	room.mutex.Lock()
+	defer room.mutex.Unlock()
+
+	switch {
+	case room.connected() < roomPlayers:
+		return errRoomPaused
+	case room.game.IsComplete():
+		return errRoomFinished
+	case room.turn != index:
+		return errNotYourTurn
+	}
+
+	matched, err := room.game.Flip(card)
+	if err != nil {
+		return err
+	}
+	if matched {
+		room.scores[index]++
+	} else if len(room.game.FaceUp) == 2 {
+		room.turn = (room.turn + 1) % roomPlayers
+	}
+
+	room.broadcast(roomEvent{Type: "flip", Player: &index, Card: &card, Matched: matched, State: room.state()})
+	return nil
+}
+
+// 名前ごとに対戦の部屋を保持する構造体．
+//
+// 複数の接続から同時に部屋を作成，削除するため，rooms へのアクセスは mutex で保護する．
+// 両方の mutex を獲得する場合は，こちらの mutex を先に獲得する．
+// maxRooms は，同時に保持する部屋の数の上限．0 の場合は制限しない．
+type roomRegistry struct {
+	mutex    sync.Mutex
+	rooms    map[string]*Room
+	maxRooms int
+}
+
+func newRoomRegistry(maxRooms int) *roomRegistry {
+	return &roomRegistry{rooms: map[string]*Room{}, maxRooms: maxRooms}
+}
+
+// name の部屋にプレイヤーを加え，その部屋とプレイヤーの番号を戻り値として返す．
+//
+// 部屋が無い場合は，create で作成したゲームの部屋を作る．
+// 保持している部屋の数が maxRooms に達している場合は，部屋を作らずに errTooManyGames を返す．
+func (registry *roomRegistry) join(name string, client *roomClient, create func() (*Game, error)) (*Room, int, error) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	room, ok := registry.rooms[name]
+	if !ok {
+		if registry.maxRooms > 0 && len(registry.rooms) >= registry.maxRooms {
+			return nil, 0, errTooManyGames
+		}
+		game, err := create()
+		if err != nil {
+			return nil, 0, err
+		}
+		room = &Room{game: game}
+		registry.rooms[name] = room
+	}
+
+	index, err := room.join(client)
+	if err != nil {
+		return nil, 0, err
+	}
+	return room, index, nil
+}
+
+// name の部屋からプレイヤー index を除き，部屋が空になった場合は部屋を削除する．
+func (registry *roomRegistry) leave(name string, room *Room, index int) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	if room.leave(index) && registry.rooms[name] == room {
+		delete(registry.rooms, name)
+	}
+}
+
+// WebSocket の接続要求の Origin ヘッダを確認し，同じホストか AllowedOrigins に含まれる送信元でなければエラーを返す．
+//
+// 別のサイトのページから勝手に部屋へ接続されることを防ぐ．Origin ヘッダの無いブラウザ以外からの接続は許可する．
+func (app *application) checkRoomOrigin(config *websocket.Config, request *http.Request) error {
+	origin := request.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	parsed, err := url.ParseRequestURI(origin)
+	if err != nil {
+		return fmt.Errorf("invalid origin %q: %w", origin, err)
+	}
+	allowed := app.config.AllowedOrigins
+	if parsed.Host != request.Host && !slices.Contains(allowed, origin) && !slices.Contains(allowed, corsAnyOrigin) {
+		return fmt.Errorf("origin %q is not allowed", origin)
+	}
+	config.Origin = parsed
+	return nil
+}
+
+// GET /ws/game/{room} を処理し，WebSocket で接続したプレイヤーを名前が room の部屋に加える．
+//
+// 部屋の名前が不正な場合は 400 を返す．満員の部屋に接続した場合は，エラーを知らせてから切断する．
+func (app *application) roomHandler(writer http.ResponseWriter, request *http.Request) {
+	name := request.PathValue("room")
+	if !roomNamePattern.MatchString(name) {
+		writeError(writer, http.StatusBadRequest, "room name must be 1 to 32 letters, digits, '-' or '_'")
+		return
+	}
+
+	server := websocket.Server{
+		Handshake: app.checkRoomOrigin,
+		Handler: func(conn *websocket.Conn) {
+			app.serveRoomClient(name, conn)
+		},
+	}
+	server.ServeHTTP(writer, request)
+}
+
+// WebSocket の接続を name の部屋のプレイヤーとし，切断されるまでプレイヤーからのメッセージを処理する．
+func (app *application) serveRoomClient(name string, conn *websocket.Conn) {
+	defer conn.Close()
+
+	// 対戦は長く続くため，サーバーが読み書きに設けた期限を外す．
+	// 一方で，巨大なメッセージでメモリを使い果たされないよう，リクエストボディと同じ大きさに制限する．
+	conn.SetDeadline(time.Time{})
+	conn.MaxPayloadBytes = int(app.config.MaxRequestBytes)
+
+	client := &roomClient{conn: conn, send: make(chan roomEvent, roomSendBuffer)}
+	room, index, err := app.rooms.join(name, client, func() (*Game, error) {
+		rows, cols := gridForPairs(defaultPairs)
+		return app.startGame(defaultTheme, rows, cols, BoardOptions{})
+	})
+	if err != nil {
+		websocket.JSON.Send(conn, roomEvent{Type: "error", Message: err.Error()})
+		return
+	}
+	go client.writeLoop()
+	defer app.rooms.leave(name, room, index)
+
+	for {
+		var request roomRequest
+		err := websocket.JSON.Receive(conn, &request)
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+			err = errors.New("message must be JSON such as {\"type\": \"flip\", \"card\": 0}")
+		} else if err != nil {
+			return
+		} else if request.Type == "flip" {
+			err = room.flip(index, request.Card)
+		} else {
+			err = errUnknownRoomRequest
+		}
+
+		if err != nil {
+			room.mutex.Lock()
+			room.notify(index, roomEvent{Type: "error", Message: err.Error()})
+			room.mutex.Unlock()
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// 部屋からのメッセージを待つ時間の上限．
+const roomTestTimeout = 5 * time.Second
+
+// server の name の部屋に WebSocket で接続し，その接続を戻り値として返す．接続はテストの終了時に閉じる．
+func dialRoom(t *testing.T, server *testServer, name string) *websocket.Conn {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(server.server.URL, "http") + "/ws/game/" + name
+	conn, err := websocket.Dial(url, "", server.server.URL)
+	if err != nil {
+		t.Fatalf("websocket.Dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// conn から部屋のメッセージを1つ受け取り，その種類が want であることを確認して戻り値として返す．
+func receiveRoomEvent(t *testing.T, conn *websocket.Conn, want string) roomEvent {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(roomTestTimeout))
+	var event roomEvent
+	err := websocket.JSON.Receive(conn, &event)
+	if err != nil {
+		t.Fatalf("waiting for %q: %v", want, err)
+	}
+	if event.Type != want {
+		t.Fatalf("received %+v, want type %q", event, want)
+	}
+	return event
+}
+
+// conn から部屋にメッセージを送る．
+func sendRoomRequest(t *testing.T, conn *websocket.Conn, request roomRequest) {
+	t.Helper()
+	err := websocket.JSON.Send(conn, request)
+	if err != nil {
+		t.Fatalf("sending %+v: %v", request, err)
+	}
+}
+
+// 2人が部屋に入って交互にめくり，3人目は入れず，切断すると一時停止し，空いた番号に入り直すと続きから対戦できることを確認する．
+func TestRoom(t *testing.T) {
+	server := newTestServer(t, newTestConfig(t))
+
+	first := dialRoom(t, server, "lobby")
+	if event := receiveRoomEvent(t, first, "state"); event.You != 0 || !event.State.Paused || event.State.Players != 1 {
+		t.Fatalf("first player: %+v, want player 0 waiting alone", event)
+	}
+	second := dialRoom(t, server, "lobby")
+	if event := receiveRoomEvent(t, second, "state"); event.You != 1 || event.State.Paused || event.State.Players != 2 {
+		t.Fatalf("second player: %+v, want player 1 with the game running", event.State)
+	}
+	receiveRoomEvent(t, first, "state")
+
+	// 満員の部屋には入れない．
+	third := dialRoom(t, server, "lobby")
+	if event := receiveRoomEvent(t, third, "error"); event.Message != errRoomFull.Error() {
+		t.Errorf("third player: message %q, want %q", event.Message, errRoomFull)
+	}
+
+	// 相手の番にはめくれず，自分の番にめくると両方に知らされる．
+	sendRoomRequest(t, second, roomRequest{Type: "flip", Card: 0})
+	if event := receiveRoomEvent(t, second, "error"); event.Message != errNotYourTurn.Error() {
+		t.Errorf("flip out of turn: message %q, want %q", event.Message, errNotYourTurn)
+	}
+	sendRoomRequest(t, first, roomRequest{Type: "flip", Card: 0})
+	for _, conn := range []*websocket.Conn{first, second} {
+		if event := receiveRoomEvent(t, conn, "flip"); *event.Player != 0 || *event.Card != 0 {
+			t.Errorf("flip event %+v, want player 0 flipping card 0", event)
+		}
+	}
+
+	// 相手が切断すると一時停止し，めくれなくなる．
+	second.Close()
+	if event := receiveRoomEvent(t, first, "paused"); !event.State.Paused {
+		t.Errorf("after disconnecting: %+v, want the game paused", event.State)
+	}
+	sendRoomRequest(t, first, roomRequest{Type: "flip", Card: 1})
+	if event := receiveRoomEvent(t, first, "error"); event.Message != errRoomPaused.Error() {
+		t.Errorf("flip while paused: message %q, want %q", event.Message, errRoomPaused)
+	}
+
+	// 空いた番号に入り直すと，めくったカードを残したまま続きから対戦する．
+	rejoined := dialRoom(t, server, "lobby")
+	event := receiveRoomEvent(t, rejoined, "state")
+	if event.You != 1 || event.State.Paused || !event.State.Cards[0].FaceUp {
+		t.Errorf("rejoined player: %+v, want player 1 resuming with card 0 face up", event)
+	}
+}
+
+// 部屋に送るメッセージが MaxRequestBytes を超えると切断されることを確認する．
+func TestRoomMaxPayload(t *testing.T) {
+	config := newTestConfig(t)
+	config.MaxRequestBytes = 1 << 10
+	server := newTestServer(t, config)
+
+	conn := dialRoom(t, server, "big")
+	receiveRoomEvent(t, conn, "state")
+	err := websocket.Message.Send(conn, `{"type": "`+strings.Repeat("a", int(config.MaxRequestBytes))+`"}`)
+	if err != nil {
+		t.Fatalf("sending: %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(roomTestTimeout))
+	var event roomEvent
+	err = websocket.JSON.Receive(conn, &event)
+	if err == nil {
+		t.Errorf("received %+v, want the connection closed", event)
+	}
+}
+
+// 部屋の数が MaxActiveGames に達すると，新しい部屋を作れないことを確認する．
+func TestRoomMaxActiveGames(t *testing.T) {
+	config := newTestConfig(t)
+	config.MaxActiveGames = 1
+	server := newTestServer(t, config)
+
+	receiveRoomEvent(t, dialRoom(t, server, "one"), "state")
+	if event := receiveRoomEvent(t, dialRoom(t, server, "two"), "error"); event.Message != errTooManyGames.Error() {
+		t.Errorf("second room: message %q, want %q", event.Message, errTooManyGames)
+	}
+	receiveRoomEvent(t, dialRoom(t, server, "one"), "state")
+}
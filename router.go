@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// リクエストの処理に用いる，サーバー全体で共有する状態をまとめた構造体．
+//
+// config は，プログラム実行時の設定．
+// sessions は，セッションごとのゲームの状態．
+// leaderboard は，記録された成績の保存先．
+// dailyScores は，日替わりの盤面で記録された日付ごとの成績の保存先．
+// themes は，カードの絵柄に用いる画像のテーマごとの一覧．POST /admin/reload で丸ごと差し替えるため，currentThemes を通して読み出す．
+// templates は，起動時に読み込んだ全てのページのテンプレート．
+// metrics は，運用の監視に用いる計測値．
+// random は，盤面の並べ替えやヒントに用いる乱数の生成元．
+// rooms は，2人で対戦する部屋の一覧．
+// sprites は，テーマごとに作成済みのスプライト．
+// results は，ゲームごとに作成済みの共有用の成績の画像．
+type application struct {
+	config      *Configuration
+	sessions    *sessionStore
+	leaderboard ScoreStore
+	dailyScores *dailyScores
+	themes      atomic.Pointer[imageThemes]
+	templates   *template.Template
+	metrics     *metrics
+	random      *randomSource
+	rooms       *roomRegistry
+	sprites     *spriteCache
+	results     *resultCache
+}
+
+// 設定と成績の保存先を受け取り，テンプレートと絵柄の画像を読み込んだ application を戻り値として返す．
+//
+// テンプレートに誤りがある場合は，最初のリクエストを待たずにここでエラーを返す．
+func newApplication(config *Configuration, leaderboard ScoreStore) (*application, error) {
+	info, err := os.Stat(config.StaticDir)
+	if err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("StaticDir %q must be an existing directory of static files", config.StaticDir)
+	}
+
+	templates, err := loadTemplates(config.TemplateDir, config)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse templates in TemplateDir %q: %w", config.TemplateDir, err)
+	}
+
+	themes, err := loadThemes(config.ImageDir, config.urlFor(imageURLPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("cannot load images from %q: %w", config.ImageDir, err)
+	}
+
+	app := &application{
+		config:      config,
+		sessions:    newSessionStore(config.MaxActiveGames),
+		leaderboard: leaderboard,
+		dailyScores: newDailyScores(config.ScoreBackend, config.ScoresFile),
+		templates:   templates,
+		metrics:     newMetrics(),
+		random:      newRandomSource(time.Now().UnixNano()),
+		rooms:       newRoomRegistry(config.MaxActiveGames),
+		sprites:     newSpriteCache(),
+		results:     newResultCache(config.ResultFontFile),
+	}
+	app.themes.Store(&themes)
+
+	return app, nil
+}
+
+// 現在のテーマごとの画像の一覧を戻り値として返す．
+//
+// 1つのリクエストの中では，途中で差し替えられても一貫するよう，一度読み出した一覧を使い続けること．
+func (app *application) currentThemes() imageThemes {
+	return *app.themes.Load()
+}
+
+// 全てのハンドラとミドルウェアを登録したハンドラを戻り値として返す．
+//
+// ポートを開かずに httptest などから直接呼び出せるよう，サーバーの起動とは分けている．
+func newRouter(app *application) http.Handler {
+	config := app.config
+
+	// マルチプレクサを用意する．
+	mux := http.NewServeMux()
+
+	// ウェブサイト表示に用いるファイル群を取得する．
+	files := staticHandler(config.StaticDir, time.Duration(config.StaticMaxAge))
+	mux.Handle("/game/", http.StripPrefix("/game/", files))
+	images := staticHandler(config.ImageDir, time.Duration(config.StaticMaxAge))
+	mux.Handle(imageURLPrefix, http.StripPrefix(imageURLPrefix, images))
+
+	// ハンドラを登録する．
+	// JSON API のハンドラは，誤ったメソッドに JSON で 405 を返せるよう，メソッドを各ハンドラの中で確認する．
+	mux.HandleFunc("/{$}", app.processTitle)
+	mux.HandleFunc("/game", app.processGame)
+	mux.HandleFunc("/api/board", app.boardHandler)
+	mux.HandleFunc("/api/flip", app.flipHandler)
+	mux.HandleFunc("/api/new", app.newGameHandler)
+	mux.HandleFunc("/api/theme", app.themeHandler)
+	mux.HandleFunc("/api/theme/{name}/sprite", app.spriteHandler)
+	mux.HandleFunc("/api/theme/{name}/sprite.png", app.spriteImageHandler)
+	mux.HandleFunc("/api/hint", app.hintHandler)
+	mux.HandleFunc("/api/status", app.statusHandler)
+	mux.HandleFunc("/api/game/{id}", app.saveGameHandler)
+	mux.HandleFunc("/api/game/{id}/replay", app.replayHandler)
+	mux.HandleFunc("/api/game/{id}/result.png", app.resultImageHandler)
+	mux.HandleFunc("/api/game", app.restoreGameHandler)
+	mux.HandleFunc("/api/leaderboard", app.leaderboardHandler)
+	mux.HandleFunc("/api/daily", app.dailyHandler)
+	mux.HandleFunc("/api/daily/leaderboard", app.dailyLeaderboardHandler)
+	mux.HandleFunc("/api/options", app.optionsHandler)
+	mux.HandleFunc("GET /ws/game/{room}", app.roomHandler)
+	mux.HandleFunc("GET /healthz", app.healthHandler)
+	mux.HandleFunc("GET /metrics", app.metricsHandler)
+	mux.HandleFunc("GET /version", versionHandler)
+	mux.HandleFunc("POST /admin/reload", app.requireAdmin(app.reloadHandler))
+
+	// どのパターンにも一致しないパスには 404 のページを返す．
+	mux.HandleFunc("/", app.notFoundHandler)
+
+	// 全てのリクエストに共通する処理を加える．
+	var handler http.Handler = mux
+	handler = limitRequestBody(handler, config.MaxRequestBytes)
+	handler = sessionMiddleware(handler, config.urlFor("/"), config.TLSEnabled())
+	handler = corsMiddleware(handler, config.AllowedOrigins)
+	handler = logRequests(handler, config.LogFormat)
+	handler = requestIDMiddleware(handler)
+	handler = recoverMiddleware(handler)
+
+	// BasePath の下に置く場合は，BasePath を取り除いたパスで以上のハンドラに渡す．
+	if config.BasePath != "" {
+		mounted := http.NewServeMux()
+		mounted.Handle(config.BasePath+"/", http.StripPrefix(config.BasePath, handler))
+		handler = mounted
+	}
+
+	return handler
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"time"
+)
+
+// 保存と再開のために JSON として書き出すゲームの状態．
+//
+// Board は，盤面．揃っておらず裏になっているカードは，絵柄を明かさないよう ImageURL を空にする．
+// Hidden は，裏になっているカードの絵柄の URL を，並びが分からないよう整列した一覧．
+// Theme は，盤面の絵柄に用いたテーマの名前．
+// ElapsedSeconds は，ゲームを始めてから保存するまでの秒数．
+// RemainingSeconds は，制限時間のあるゲームで保存した時点の残り秒数．制限時間が無ければ含めない．
+type savedGame struct {
+	Token          string   `json:"token"`
+	Board          *Board   `json:"board"`
+	Hidden         []string `json:"hidden"`
+	Theme          string   `json:"theme"`
+	FaceUp         []int    `json:"faceUp"`
+	Moves          int      `json:"moves"`
+	Matches        int      `json:"matches"`
+	HintsUsed      int      `json:"hintsUsed"`
+	ElapsedSeconds float64  `json:"elapsedSeconds"`
+
+	RemainingSeconds *float64 `json:"remainingSeconds,omitempty"`
+}
+
+// ゲームの現在の状態を，保存用の形式に変換して戻り値として返す．
+//
+// 戻り値はゲームの盤面を共有しないため，排他の外で書き出してよい．
+// 保存した状態から盤面を解けないよう，裏になっているカードの絵柄は位置を除いて Hidden に移す．
+func (game *Game) save() savedGame {
+	now := time.Now()
+	board := *game.Board
+	board.Cards = make([]Card, len(game.Board.Cards))
+	hidden := []string{}
+	for i, card := range game.Board.Cards {
+		if card.Matched || game.isFaceUp(i) {
+			board.Cards[i] = card
+			continue
+		}
+		hidden = append(hidden, card.ImageURL)
+	}
+	slices.Sort(hidden)
+
+	var remaining *float64
+	if game.IsTimed() {
+		seconds := game.Remaining(now).Seconds()
+		remaining = &seconds
+	}
+
+	return savedGame{
+		Token:          game.Token,
+		Board:          &board,
+		Hidden:         hidden,
+		Theme:          game.Theme,
+		FaceUp:         append([]int(nil), game.FaceUp...),
+		Moves:          game.Moves,
+		Matches:        game.Matches,
+		HintsUsed:      game.HintsUsed,
+		ElapsedSeconds: game.Elapsed(now).Seconds(),
+
+		RemainingSeconds: remaining,
+	}
+}
+
+// 保存された状態の裏になっているカードに，Hidden の絵柄を random を用いてランダムに配り直す．
+//
+// 配り直した後の絵柄ごとに，カードの ID を振り直す．裏になっているカードと Hidden の数が合わない場合はエラーを返す．
+func (saved *savedGame) dealHidden(random *rand.Rand) error {
+	board := saved.Board
+	if board == nil {
+		return errors.New("board is missing")
+	}
+	positions := []int{}
+	for i, card := range board.Cards {
+		if card.ImageURL == "" {
+			positions = append(positions, i)
+		}
+	}
+	if len(positions) != len(saved.Hidden) {
+		return fmt.Errorf("%d cards are hidden but %d hidden pictures are listed", len(positions), len(saved.Hidden))
+	}
+
+	hidden := append([]string(nil), saved.Hidden...)
+	random.Shuffle(len(hidden), func(i, j int) {
+		hidden[i], hidden[j] = hidden[j], hidden[i]
+	})
+	for i, position := range positions {
+		board.Cards[position] = Card{ImageURL: hidden[i]}
+	}
+	ids := map[string]int{}
+	for i, card := range board.Cards {
+		id, ok := ids[card.ImageURL]
+		if !ok {
+			id = len(ids)
+			ids[card.ImageURL] = id
+		}
+		board.Cards[i].ID = id
+	}
+	saved.Hidden = nil
+
+	return nil
+}
+
+// 裏になっているカードの絵柄を配り直した保存された状態を検証し，そこから再開するゲームを戻り値として返す．
+//
+// images は，保存されたテーマの画像の URL の一覧．
+// 再開したゲームには新しいトークンを発行する．保存された状態に矛盾がある場合はその理由を表すエラーを返す．
+// 保存された状態はクライアントが書き換えられるため，再開したゲームはリーダーボードに記録しない．
+func restoreGame(saved savedGame, images []string) (*Game, error) {
+	err := saved.validate(images)
+	if err != nil {
+		return nil, err
+	}
+
+	game, err := NewGame(saved.Board)
+	if err != nil {
+		return nil, err
+	}
+	game.Theme = saved.Theme
+	game.Unranked = true
+	game.FaceUp = saved.FaceUp
+	game.Moves = saved.Moves
+	game.ReplayTruncated = saved.Moves > 0 || len(saved.FaceUp) > 0
+	game.Matches = saved.Matches
+	game.HintsUsed = saved.HintsUsed
+	game.StartedAt = time.Now().Add(-time.Duration(saved.ElapsedSeconds * float64(time.Second)))
+	if game.IsComplete() {
+		game.FinishedAt = time.Now()
+	}
+	if saved.RemainingSeconds != nil {
+		game.Deadline = time.Now().Add(time.Duration(*saved.RemainingSeconds * float64(time.Second)))
+	}
+
+	return game, nil
+}
+
+// 保存されたゲームの状態に矛盾が無いか確認し，矛盾がある場合はその理由を表すエラーを返す．
+//
+// カードの絵柄は，保存されたテーマの画像の URL の一覧 images に含まれる必要がある．
+func (saved *savedGame) validate(images []string) error {
+	board := saved.Board
+	if board == nil || len(board.Cards) == 0 {
+		return errors.New("board is missing")
+	}
+	if board.Rows < 1 || board.Cols < 1 || board.Rows*board.Cols != len(board.Cards) {
+		return fmt.Errorf("a %dx%d board cannot hold %d cards", board.Rows, board.Cols, len(board.Cards))
+	}
+	err := validatePairs(board.Cards)
+	if err != nil {
+		return err
+	}
+
+	// 揃っていない全てのカードに，相手となる揃っていないカードがある必要がある．
+	unmatched := 0
+	for _, card := range board.Cards {
+		if !card.Matched {
+			unmatched++
+		}
+	}
+	if solution := board.Solve(); len(solution) != unmatched {
+		return fmt.Errorf("board cannot be solved: only %d of %d unmatched cards can be matched", len(solution), unmatched)
+	}
+
+	// 同じ絵柄の2枚のカードは，同じ ID を持ち，揃っているかどうかも一致する必要がある．
+	pairs := map[int][]Card{}
+	for _, card := range board.Cards {
+		if !slices.Contains(images, card.ImageURL) {
+			return fmt.Errorf("image %q is not in theme %q", card.ImageURL, saved.Theme)
+		}
+		pairs[card.ID] = append(pairs[card.ID], card)
+	}
+	matches := 0
+	for id, cards := range pairs {
+		if len(cards) != 2 || cards[0].ImageURL != cards[1].ImageURL {
+			return fmt.Errorf("card id %d does not identify exactly one pair", id)
+		}
+		if cards[0].Matched != cards[1].Matched {
+			return fmt.Errorf("only one card of pair %d is matched", id)
+		}
+		if cards[0].Matched {
+			matches++
+		}
+	}
+	if matches != saved.Matches {
+		return fmt.Errorf("matches is %d but %d pairs are matched", saved.Matches, matches)
+	}
+
+	// 表になっているカードは，揃っていない別々のカードで，2枚までである必要がある．
+	if len(saved.FaceUp) > 2 {
+		return fmt.Errorf("%d cards are face up", len(saved.FaceUp))
+	}
+	for i, card := range saved.FaceUp {
+		if card < 0 || card >= len(board.Cards) || board.Cards[card].Matched {
+			return fmt.Errorf("card %d cannot be face up", card)
+		}
+		if i == 1 && (card == saved.FaceUp[0] || board.Cards[card].ID == board.Cards[saved.FaceUp[0]].ID) {
+			return errors.New("face-up cards must be two different, unmatched pictures")
+		}
+	}
+
+	if saved.Moves < saved.Matches || saved.HintsUsed < 0 || saved.ElapsedSeconds < 0 {
+		return errors.New("moves, hints and elapsed time are inconsistent")
+	}
+	if saved.RemainingSeconds != nil && *saved.RemainingSeconds < 0 {
+		return errors.New("remaining time must not be negative")
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// savedGame.validate が，揃えられない盤面や矛盾する状態を理由を示すエラーと共に拒否することを確認する．
+func TestSavedGameValidate(t *testing.T) {
+	images := []string{"/images/00.png", "/images/01.png"}
+	tests := []struct {
+		name    string
+		modify  func(saved *savedGame)
+		wantErr string
+	}{
+		{name: "valid", modify: func(*savedGame) {}},
+		{
+			name:    "partner already matched",
+			modify:  func(saved *savedGame) { saved.Board.Cards[0].Matched = true },
+			wantErr: "board cannot be solved: only 2 of 3 unmatched cards can be matched",
+		},
+		{
+			name:    "ids split across pictures",
+			modify:  func(saved *savedGame) { saved.Board.Cards[1].ID, saved.Board.Cards[3].ID = 0, 1 },
+			wantErr: "does not identify exactly one pair",
+		},
+		{
+			name: "image outside the theme",
+			modify: func(saved *savedGame) {
+				saved.Board.Cards[0].ImageURL, saved.Board.Cards[3].ImageURL = "/x.png", "/x.png"
+			},
+			wantErr: `image "/x.png" is not in theme`,
+		},
+		{
+			name:    "matches out of sync",
+			modify:  func(saved *savedGame) { saved.Matches = 1 },
+			wantErr: "matches is 1 but 0 pairs are matched",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			saved := savedGame{Board: newTestBoard(0, 1, 1, 0)}
+			saved.Board.Rows, saved.Board.Cols = 2, 2
+			test.modify(&saved)
+
+			err := saved.validate(images)
+			if test.wantErr == "" {
+				if err != nil {
+					t.Errorf("validate: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("validate error = %v, want it to mention %q", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import "fmt"
+
+// 成績の保存形式の名前．
+const (
+	scoreBackendFile   = "file"
+	scoreBackendSQLite = "sqlite"
+)
+
+// リーダーボードの成績の保存先．
+//
+// ハンドラは保存形式を知らずに済むよう，この interface を通して成績を読み書きする．
+// 複数のリクエストから同時に呼ばれるため，実装は並行に呼び出せる必要がある．
+type ScoreStore interface {
+	// プレイヤーの名前と成績を受け取って保存する．上位 maxLeaderboardEntries 件に入らない成績は保持しない．
+	Add(name string, score Score) error
+
+	// 得点の高い順に最大 n 件の成績を戻り値として返す．同点の場合は先に記録された成績を上位とする．
+	Top(n int) ([]LeaderboardEntry, error)
+
+	// 保持している成績の件数を戻り値として返す．
+	Len() (int, error)
+
+	// 保存先を閉じる．
+	Close() error
+}
+
+// 保存形式 backend に従って path にある成績の保存先を開き，戻り値として返す．
+//
+// backend には，設定の ScoreBackend に指定できる名前を指定する．
+func openScoreStore(backend string, path string) (ScoreStore, error) {
+	var store ScoreStore
+	var err error
+	switch backend {
+	case scoreBackendSQLite:
+		store, err = openSQLiteScoreStore(path)
+	default:
+		store, err = openFileScoreStore(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot load scores from %q: %w", path, err)
+	}
+	return store, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// セッション ID を保存するクッキーの名前．
+const sessionCookieName = "picmatch_session"
+
+// セッション ID やゲームのトークンに用いる乱数のバイト数．
+const randomIDBytes = 16
+
+// セッション ID やゲームのトークンに用いる，推測されにくいランダムな文字列を戻り値として返す．
+func newRandomID() (string, error) {
+	buffer := make([]byte, randomIDBytes)
+	_, err := rand.Read(buffer)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buffer), nil
+}
+
+// リクエストのコンテキストにセッション ID を格納する際のキーの型．
+type sessionContextKey struct{}
+
+// リクエストのコンテキストからセッション ID を取り出して戻り値として返す．
+//
+// sessionMiddleware を通ったリクエストでなければ空文字列を返す．
+func sessionIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(sessionContextKey{}).(string)
+	return id
+}
+
+// リクエストのクッキーからセッション ID を取り出し，リクエストのコンテキストに格納するミドルウェア．
+//
+// クッキーが無い場合は新しいセッション ID を発行し，レスポンスのクッキーに設定する．
+// クッキーは path 以下のリクエストにのみ送られるようにする．BasePath の下に置く場合は，その下のパスを指定すること．
+// secure が true の場合，クッキーは HTTPS でのみ送られるようにする．
+func sessionMiddleware(next http.Handler, path string, secure bool) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		cookie, err := request.Cookie(sessionCookieName)
+		id := ""
+		if err == nil {
+			id = cookie.Value
+		}
+
+		if id == "" {
+			id, err = newRandomID()
+			if err != nil {
+				logRequestError(request, "Cannot issue session ID", err)
+				http.Error(writer, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			http.SetCookie(writer, &http.Cookie{
+				Name:     sessionCookieName,
+				Value:    id,
+				Path:     path,
+				HttpOnly: true,
+				Secure:   secure,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+
+		ctx := context.WithValue(request.Context(), sessionContextKey{}, id)
+		next.ServeHTTP(writer, request.WithContext(ctx))
+	})
+}
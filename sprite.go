@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// スプライトの URL で，名前が空の既定のテーマを表すパスの要素．同じ名前のテーマと区別できないため，設定の検証で ImageDir に置くことを禁じる．
+const defaultThemePathName = "default"
+
+// テーマの画像を1枚にまとめたスプライト．
+//
+// modTime は，スプライトを作った時点のテーマの画像の最終更新時刻のうち最も新しいもの．
+// images は，スプライトを作った時点のテーマの画像の URL の一覧．
+// png は，スプライトを PNG として符号化したデータ．
+// cells は，画像ごとのスプライト中の位置と大きさ．
+type sprite struct {
+	modTime time.Time
+	images  []string
+	width   int
+	height  int
+	png     []byte
+	cells   []spriteCell
+}
+
+// スプライト中の1枚の画像の位置と大きさ．
+type spriteCell struct {
+	ImageURL string `json:"imageUrl"`
+	X        int    `json:"x"`
+	Y        int    `json:"y"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+}
+
+// テーマの名前ごとに，作成済みのスプライトを保持する構造体．
+//
+// 同じスプライトを何度も作らないよう，作成中も mutex を獲得したままとする．
+type spriteCache struct {
+	mutex   sync.Mutex
+	sprites map[string]*sprite
+}
+
+func newSpriteCache() *spriteCache {
+	return &spriteCache{sprites: map[string]*sprite{}}
+}
+
+// テーマの名前と画像の URL の一覧を受け取り，そのテーマのスプライトを戻り値として返す．
+//
+// urlPrefix は，画像ディレクトリ imageDir を配信する URL の接頭辞．
+// 画像の一覧か最終更新時刻が前回作った時点と変わっていなければ，作成済みのスプライトを返す．
+func (cache *spriteCache) get(imageDir string, urlPrefix string, theme string, images []string) (*sprite, error) {
+	modTime, err := latestModTime(imageDir, urlPrefix, images)
+	if err != nil {
+		return nil, err
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cached, ok := cache.sprites[theme]
+	if ok && cached.modTime.Equal(modTime) && slices.Equal(cached.images, images) {
+		return cached, nil
+	}
+	built, err := buildSprite(imageDir, urlPrefix, images)
+	if err != nil {
+		return nil, err
+	}
+	built.modTime = modTime
+	cache.sprites[theme] = built
+
+	return built, nil
+}
+
+// urlPrefix で配信される画像の URL を受け取り，imageDir 中のその画像のファイルのパスを戻り値として返す．
+func imageFilePath(imageDir string, urlPrefix string, imageURL string) string {
+	return filepath.Join(imageDir, filepath.FromSlash(strings.TrimPrefix(imageURL, urlPrefix)))
+}
+
+// 画像の URL の一覧を受け取り，それらのファイルの最終更新時刻のうち最も新しいものを戻り値として返す．
+func latestModTime(imageDir string, urlPrefix string, images []string) (time.Time, error) {
+	var latest time.Time
+	for _, imageURL := range images {
+		info, err := os.Stat(imageFilePath(imageDir, urlPrefix, imageURL))
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// 画像の URL の一覧を受け取り，それらの画像をなるべく正方形に近い格子に並べたスプライトを戻り値として返す．
+//
+// 格子の1マスの大きさは，最も大きい画像の幅と高さとする．画像を復号できなかった場合は，その画像を示すエラーを返す．
+func buildSprite(imageDir string, urlPrefix string, images []string) (*sprite, error) {
+	decoded := make([]image.Image, len(images))
+	cellWidth, cellHeight := 0, 0
+	for i, imageURL := range images {
+		file, err := os.Open(imageFilePath(imageDir, urlPrefix, imageURL))
+		if err != nil {
+			return nil, err
+		}
+		decoded[i], _, err = image.Decode(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode image %q: %w", imageURL, err)
+		}
+		bounds := decoded[i].Bounds()
+		cellWidth = max(cellWidth, bounds.Dx())
+		cellHeight = max(cellHeight, bounds.Dy())
+	}
+
+	cols := int(math.Ceil(math.Sqrt(float64(len(images)))))
+	rows := (len(images) + cols - 1) / cols
+	canvas := image.NewNRGBA(image.Rect(0, 0, cols*cellWidth, rows*cellHeight))
+	result := &sprite{
+		images: images,
+		width:  canvas.Bounds().Dx(),
+		height: canvas.Bounds().Dy(),
+		cells:  make([]spriteCell, len(images)),
+	}
+	for i, picture := range decoded {
+		bounds := picture.Bounds()
+		x, y := (i%cols)*cellWidth, (i/cols)*cellHeight
+		draw.Draw(canvas, image.Rect(x, y, x+bounds.Dx(), y+bounds.Dy()), picture, bounds.Min, draw.Src)
+		result.cells[i] = spriteCell{
+			ImageURL: images[i],
+			X:        x,
+			Y:        y,
+			Width:    bounds.Dx(),
+			Height:   bounds.Dy(),
+		}
+	}
+
+	var buffer bytes.Buffer
+	err := png.Encode(&buffer, canvas)
+	if err != nil {
+		return nil, err
+	}
+	result.png = buffer.Bytes()
+
+	return result, nil
+}
+
+// GET /api/theme/{name}/sprite のレスポンスの形式．
+//
+// SpriteURL は，スプライトの PNG 画像の URL．
+// Width と Height は，スプライト全体の大きさ．
+// Images は，テーマの画像ごとのスプライト中の位置と大きさ．
+type spriteResponse struct {
+	SpriteURL string       `json:"spriteUrl"`
+	Width     int          `json:"width"`
+	Height    int          `json:"height"`
+	Images    []spriteCell `json:"images"`
+}
+
+// パスの {name} が示すテーマのスプライトを戻り値として返す．
+//
+// 存在しないテーマや画像の無いテーマの場合は 404 を，スプライトを作れなかった場合は 500 を書き込み，nil を返す．
+func (app *application) themeSprite(writer http.ResponseWriter, request *http.Request) *sprite {
+	name := request.PathValue("name")
+	theme := name
+	if name == defaultThemePathName {
+		theme = defaultTheme
+	}
+	images, ok := app.currentThemes()[theme]
+	if !ok || len(images) == 0 {
+		writeError(writer, http.StatusNotFound, fmt.Sprintf("unknown theme %q", name))
+		return nil
+	}
+
+	result, err := app.sprites.get(app.config.ImageDir, app.config.urlFor(imageURLPrefix), theme, images)
+	if err != nil {
+		logRequestError(request, "Cannot build sprite for theme", name, err)
+		writeError(writer, http.StatusInternalServerError, fmt.Sprintf("cannot build sprite for theme %q", name))
+		return nil
+	}
+	return result
+}
+
+// GET /api/theme/{name}/sprite を処理し，テーマの画像を1枚にまとめたスプライトの URL と，画像ごとの位置を JSON として返す．
+//
+// 名前が空の既定のテーマは，{name} に "default" を指定して求める．
+func (app *application) spriteHandler(writer http.ResponseWriter, request *http.Request) {
+	if !requireMethod(writer, request, http.MethodGet) {
+		return
+	}
+
+	result := app.themeSprite(writer, request)
+	if result == nil {
+		return
+	}
+	writeJSON(writer, http.StatusOK, spriteResponse{
+		SpriteURL: app.config.urlFor(apiPathPrefix + "theme/" + request.PathValue("name") + "/sprite.png"),
+		Width:     result.width,
+		Height:    result.height,
+		Images:    result.cells,
+	})
+}
+
+// GET /api/theme/{name}/sprite.png を処理し，テーマの画像を1枚にまとめたスプライトを PNG 画像として返す．
+func (app *application) spriteImageHandler(writer http.ResponseWriter, request *http.Request) {
+	if !requireMethod(writer, request, http.MethodGet) {
+		return
+	}
+
+	result := app.themeSprite(writer, request)
+	if result == nil {
+		return
+	}
+	maxAge := time.Duration(app.config.StaticMaxAge)
+	writer.Header().Set("Content-Type", "image/png")
+	writer.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(maxAge.Seconds())))
+	http.ServeContent(writer, request, "", result.modTime, bytes.NewReader(result.png))
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// スプライトを作れない場合に，サーバーのパスなどの詳細を含めずに 500 を返すことを確認する．
+func TestSpriteErrorHidesDetails(t *testing.T) {
+	config := newTestConfig(t)
+	config.ImageDir = newTestImageDir(t, map[string]int{"": defaultPairs})
+	err := os.WriteFile(filepath.Join(config.ImageDir, "00.png"), []byte("not a png"), 0o644)
+	if err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	server := newTestServer(t, config)
+
+	for _, path := range []string{"/api/theme/default/sprite", "/api/theme/default/sprite.png"} {
+		response := server.do(server.newClient(), http.MethodGet, path, nil)
+		body := readBody(t, response)
+		if response.StatusCode != http.StatusInternalServerError {
+			t.Errorf("GET %s: status %d, want %d", path, response.StatusCode, http.StatusInternalServerError)
+		}
+		if strings.Contains(body, config.ImageDir) || strings.Contains(body, ".png") {
+			t.Errorf("GET %s: body %s reveals server details", path, body)
+		}
+	}
+}
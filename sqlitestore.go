@@ -0,0 +1,113 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// 成績を保存する表を作成する SQL．
+const createScoresTable = `
+CREATE TABLE IF NOT EXISTS scores (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	moves INTEGER NOT NULL,
+	hints INTEGER NOT NULL,
+	duration_seconds REAL NOT NULL,
+	points INTEGER NOT NULL,
+	recorded_at TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS scores_by_points ON scores (points DESC, id);
+`
+
+// 成績を SQLite のデータベースに保存する ScoreStore．
+//
+// 同時に書き込んで database is locked とならないよう，接続は1つに限る．
+type SQLiteScoreStore struct {
+	db *sql.DB
+}
+
+// path の SQLite のデータベースを開き，成績を保存する表が無ければ作成して，ScoreStore を戻り値として返す．
+func openSQLiteScoreStore(path string) (*SQLiteScoreStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(createScoresTable)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLiteScoreStore{db: db}, nil
+}
+
+// プレイヤーの名前と成績を受け取ってデータベースに追加する．
+//
+// 上位 maxLeaderboardEntries 件に入らない成績は削除する．
+func (store *SQLiteScoreStore) Add(name string, score Score) error {
+	tx, err := store.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		`INSERT INTO scores (name, moves, hints, duration_seconds, points, recorded_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		name, score.Moves, score.Hints, score.DurationSeconds, score.Points, time.Now().UTC().Format(time.RFC3339Nano),
+	)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		`DELETE FROM scores WHERE id NOT IN (SELECT id FROM scores ORDER BY points DESC, id LIMIT ?)`,
+		maxLeaderboardEntries,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// 得点の高い順に最大 n 件の成績を戻り値として返す．同点の場合は先に記録された成績を上位とする．
+func (store *SQLiteScoreStore) Top(n int) ([]LeaderboardEntry, error) {
+	rows, err := store.db.Query(
+		`SELECT name, moves, hints, duration_seconds, points, recorded_at FROM scores ORDER BY points DESC, id LIMIT ?`,
+		n,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	top := []LeaderboardEntry{}
+	for rows.Next() {
+		var entry LeaderboardEntry
+		var recordedAt string
+		err := rows.Scan(&entry.Name, &entry.Score.Moves, &entry.Score.Hints, &entry.Score.DurationSeconds, &entry.Score.Points, &recordedAt)
+		if err != nil {
+			return nil, err
+		}
+		entry.RecordedAt, err = time.Parse(time.RFC3339Nano, recordedAt)
+		if err != nil {
+			return nil, err
+		}
+		top = append(top, entry)
+	}
+	return top, rows.Err()
+}
+
+// 保持している成績の件数を戻り値として返す．
+func (store *SQLiteScoreStore) Len() (int, error) {
+	var count int
+	err := store.db.QueryRow(`SELECT COUNT(*) FROM scores`).Scan(&count)
+	return count, err
+}
+
+// データベースを閉じる．
+func (store *SQLiteScoreStore) Close() error {
+	return store.db.Close()
+}
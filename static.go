@@ -0,0 +1,108 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// gzip で圧縮して配信するテキストファイルの拡張子．
+//
+// png や jpg などの画像は既に圧縮されているため含めない．
+var gzipExtensions = map[string]bool{
+	".html": true,
+	".css":  true,
+	".js":   true,
+	".json": true,
+	".svg":  true,
+	".txt":  true,
+}
+
+// ファイルの更新時刻と大きさから ETag を作り，戻り値として返す．
+func fileETag(modTime time.Time, size int64) string {
+	return fmt.Sprintf(`"%x-%x"`, modTime.UnixNano(), size)
+}
+
+// If-None-Match ヘッダの値が etag と一致するかどうかを戻り値として返す．
+//
+// 弱い比較を行うため，W/ の付いた ETag も一致とみなす．
+func etagMatches(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// root 以下のファイルを，キャッシュ用のヘッダを付けて配信するハンドラを戻り値として返す．
+//
+// Cache-Control には maxAge を，ETag にはファイルの更新時刻と大きさから作った値を設定する．
+// クライアントが gzip を受け付ける場合，テキストファイルは圧縮して配信する．
+// ディレクトリや存在しないファイルへのリクエストは http.FileServer に任せる．
+func staticHandler(root string, maxAge time.Duration) http.Handler {
+	dir := http.Dir(root)
+	fileServer := http.FileServer(dir)
+
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		name := path.Clean("/" + request.URL.Path)
+		file, err := dir.Open(name)
+		if err != nil {
+			fileServer.ServeHTTP(writer, request)
+			return
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil || info.IsDir() {
+			fileServer.ServeHTTP(writer, request)
+			return
+		}
+
+		header := writer.Header()
+		header.Set("Cache-Control", fmt.Sprintf("max-age=%d", int(maxAge.Seconds())))
+		etag := fileETag(info.ModTime(), info.Size())
+
+		// 圧縮しないファイルは，条件付きリクエストの処理も含めて http.ServeContent に任せる．
+		extension := strings.ToLower(path.Ext(name))
+		if !gzipExtensions[extension] {
+			header.Set("ETag", etag)
+			http.ServeContent(writer, request, info.Name(), info.ModTime(), file)
+			return
+		}
+		header.Add("Vary", "Accept-Encoding")
+		if !strings.Contains(request.Header.Get("Accept-Encoding"), "gzip") {
+			header.Set("ETag", etag)
+			http.ServeContent(writer, request, info.Name(), info.ModTime(), file)
+			return
+		}
+
+		// 圧縮した内容は元のファイルと異なるため，別の ETag を付ける．
+		etag = strings.TrimSuffix(etag, `"`) + `-gzip"`
+		header.Set("ETag", etag)
+		if etagMatches(request.Header.Get("If-None-Match"), etag) {
+			writer.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		header.Set("Content-Type", mime.TypeByExtension(extension))
+		header.Set("Content-Encoding", "gzip")
+		header.Set("Last-Modified", info.ModTime().UTC().Format(http.TimeFormat))
+		if request.Method == http.MethodHead {
+			return
+		}
+		compressor := gzip.NewWriter(writer)
+		_, err = io.Copy(compressor, file)
+		if err == nil {
+			err = compressor.Close()
+		}
+		if err != nil {
+			logRequestError(request, "Cannot send compressed file", name, err)
+		}
+	})
+}
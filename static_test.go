@@ -0,0 +1,105 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// staticHandler がキャッシュ用のヘッダを付け，テキストファイルのみを gzip で圧縮し，
+// If-None-Match が ETag と一致する場合は圧縮の有無に関わらず 304 を返すことを確認する．
+func TestStaticHandler(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"style.css": "body { color: black; }",
+		"app.js":    "console.log('hello');",
+		"card.png":  "\x89PNG not really an image",
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644)
+		if err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+	server := httptest.NewServer(staticHandler(root, time.Hour))
+	t.Cleanup(server.Close)
+	// 圧縮された内容をそのまま確かめるよう，自動での展開を止める．
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+
+	get := func(name, acceptEncoding, ifNoneMatch string) *http.Response {
+		t.Helper()
+		request, err := http.NewRequest(http.MethodGet, server.URL+"/"+name, nil)
+		if err != nil {
+			t.Fatalf("http.NewRequest: %v", err)
+		}
+		if acceptEncoding != "" {
+			request.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		if ifNoneMatch != "" {
+			request.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		response, err := client.Do(request)
+		if err != nil {
+			t.Fatalf("GET %s: %v", name, err)
+		}
+		t.Cleanup(func() { response.Body.Close() })
+		return response
+	}
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		wantGzip       bool
+	}{
+		{name: "style.css", acceptEncoding: "gzip, deflate", wantGzip: true},
+		{name: "app.js", acceptEncoding: "gzip", wantGzip: true},
+		{name: "app.js"},
+		{name: "card.png", acceptEncoding: "gzip"},
+	}
+	for _, test := range tests {
+		t.Run(test.name+" "+test.acceptEncoding, func(t *testing.T) {
+			response := get(test.name, test.acceptEncoding, "")
+			if response.StatusCode != http.StatusOK {
+				t.Fatalf("status = %d, want %d", response.StatusCode, http.StatusOK)
+			}
+			if got := response.Header.Get("Cache-Control"); got != "max-age=3600" {
+				t.Errorf("Cache-Control = %q, want %q", got, "max-age=3600")
+			}
+			etag := response.Header.Get("ETag")
+			if etag == "" {
+				t.Fatal("no ETag")
+			}
+
+			gzipped := response.Header.Get("Content-Encoding") == "gzip"
+			if gzipped != test.wantGzip {
+				t.Errorf("Content-Encoding = %q, want gzip %v", response.Header.Get("Content-Encoding"), test.wantGzip)
+			}
+			var body io.Reader = response.Body
+			if gzipped {
+				reader, err := gzip.NewReader(response.Body)
+				if err != nil {
+					t.Fatalf("gzip.NewReader: %v", err)
+				}
+				body = reader
+			}
+			data, err := io.ReadAll(body)
+			if err != nil || string(data) != files[test.name] {
+				t.Errorf("body = %q, %v, want %q", data, err, files[test.name])
+			}
+
+			response = get(test.name, test.acceptEncoding, etag)
+			if response.StatusCode != http.StatusNotModified {
+				t.Errorf("If-None-Match %s: status = %d, want %d", etag, response.StatusCode, http.StatusNotModified)
+			}
+			response = get(test.name, test.acceptEncoding, `"stale"`)
+			if response.StatusCode != http.StatusOK {
+				t.Errorf("stale If-None-Match: status = %d, want %d", response.StatusCode, http.StatusOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// 遊ばれているゲームの数が上限に達し，新しいゲームを始められないことを表すエラー．
+var errTooManyGames = errors.New("too many active games")
+
+// 1つのセッションが保持する状態．
+//
+// game は，セッションで遊んでいるゲーム．同じセッションからの並行なリクエストが同時に変更しないよう，mutex で保護する．
+// token は，索引に登録した game のトークン．
+// lastSeen は，セッションが最後に参照された時刻．
+// flips は，カードをめくる頻度を制限するためのトークンバケット．
+// playerName は，プレイヤーが最後に名乗った名前．まだ名乗っていなければ空文字列．
+// theme は，プレイヤーが POST /api/theme で選んだテーマの名前．新しく始めるゲームに引き継ぐ．まだ選んでいなければ既定のテーマ．
+// dailyRecorded は，日替わりの盤面の成績を最後にリーダーボードに記録した日付．まだ記録していなければ空文字列．
+// token，lastSeen，flips，playerName，theme，dailyRecorded は，sessionStore の mutex で保護する．
+type session struct {
+	mutex      sync.Mutex
+	game       *Game
+	token      string
+	lastSeen   time.Time
+	flips      tokenBucket
+	playerName string
+	theme      string
+
+	dailyRecorded string
+}
+
+// セッション ID ごとのゲームの状態を保持する構造体．
+//
+// tokens は，ゲームのトークンからそのゲームを持つセッション ID を引くための索引．
+// 複数のリクエストや掃除用のゴルーチンから同時に参照されるため，sessions と tokens へのアクセスは mutex で保護する．
+// 各ゲームの操作は，セッションごとの mutex で直列化し，別々のセッションのゲームは並行に操作できるようにする．
+// 両方の mutex を獲得する場合は，セッションの mutex を先に獲得する．
+// maxGames は，同時に保持するゲームの数の上限．0 の場合は制限しない．
+type sessionStore struct {
+	mutex    sync.Mutex
+	sessions map[string]*session
+	tokens   map[string]string
+	maxGames int
+}
+
+func newSessionStore(maxGames int) *sessionStore {
+	return &sessionStore{sessions: map[string]*session{}, tokens: map[string]string{}, maxGames: maxGames}
+}
+
+// 保持しているゲームの数を戻り値として返す．
+func (store *sessionStore) count() int {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	return len(store.sessions)
+}
+
+// game を持つ新しいセッションを id として登録し，トークンの索引にも加える．呼び出し側で mutex を獲得しておくこと．
+func (store *sessionStore) add(id string, game *Game) *session {
+	current := &session{game: game, token: game.Token, lastSeen: time.Now()}
+	store.sessions[id] = current
+	store.tokens[game.Token] = id
+
+	return current
+}
+
+// id のセッションを削除し，トークンの索引からも除く．呼び出し側で mutex を獲得しておくこと．
+//
+// セッションのゲームへの参照は残さないため，ゲームのめくり方の記録も共に解放される．
+func (store *sessionStore) remove(id string) {
+	if current, ok := store.sessions[id]; ok {
+		delete(store.tokens, current.token)
+	}
+	delete(store.sessions, id)
+}
+
+// id のセッションを取り出して参照された時刻を更新し，戻り値として返す．
+//
+// id のセッションが無い場合は，create で作成したゲームを持つセッションを登録する．create が nil の場合は登録せずに nil を返す．
+// 保持しているゲームの数が maxGames に達している場合は，登録せずに errTooManyGames を返す．
+func (store *sessionStore) touch(id string, create func() (*Game, error)) (*session, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	current, ok := store.sessions[id]
+	if !ok {
+		if create == nil {
+			return nil, nil
+		}
+		if store.maxGames > 0 && len(store.sessions) >= store.maxGames {
+			return nil, errTooManyGames
+		}
+		game, err := create()
+		if err != nil {
+			return nil, err
+		}
+		return store.add(id, game), nil
+	}
+	current.lastSeen = time.Now()
+
+	return current, nil
+}
+
+// id のゲームを取り出し，同じセッションの他のリクエストを排他した状態で fn に渡す．
+//
+// id のゲームが無い場合は，create で作成したゲームを登録してから渡す．
+// create が失敗した場合は fn を呼ばずにそのエラーを返す．
+func (store *sessionStore) update(id string, create func() (*Game, error), fn func(game *Game)) error {
+	current, err := store.touch(id, create)
+	if err != nil {
+		return err
+	}
+
+	current.mutex.Lock()
+	defer current.mutex.Unlock()
+	fn(current.game)
+
+	return nil
+}
+
+// id のゲームを取り出し，同じセッションの他のリクエストを排他した状態で fn に渡す．
+//
+// id のゲームが無い場合は fn を呼ばずに false を返す．
+func (store *sessionStore) lookup(id string, fn func(game *Game)) bool {
+	current, _ := store.touch(id, nil)
+	if current == nil {
+		return false
+	}
+
+	current.mutex.Lock()
+	defer current.mutex.Unlock()
+	fn(current.game)
+
+	return true
+}
+
+// id のセッションでカードを1回めくってよいか，1秒あたり rate 回の頻度制限に従って判定する．
+//
+// めくってよい場合は true を返す．そうでない場合は false と，次にめくれるまでの時間を返す．
+// rate が 0 の場合や，まだセッションが無い場合は制限しない．
+func (store *sessionStore) allowFlip(id string, rate float64) (bool, time.Duration) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	current, ok := store.sessions[id]
+	if rate == 0 || !ok {
+		return true, 0
+	}
+	return current.flips.take(rate, math.Max(rate, 1), time.Now())
+}
+
+// id のセッションのプレイヤーが名乗った名前として name を記録する．
+//
+// まだセッションが無い場合は何もしない．
+func (store *sessionStore) setPlayerName(id string, name string) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if current, ok := store.sessions[id]; ok {
+		current.playerName = name
+	}
+}
+
+// id のセッションのプレイヤーが最後に名乗った名前を戻り値として返す．
+//
+// まだ名乗っていない場合やセッションが無い場合は，空文字列を返す．
+func (store *sessionStore) playerName(id string) string {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if current, ok := store.sessions[id]; ok {
+		return current.playerName
+	}
+	return ""
+}
+
+// id のセッションのプレイヤーが選んだテーマとして theme を記録する．
+//
+// まだセッションが無い場合は，create で作成したゲームを持つセッションを登録してから記録する．
+// create が失敗した場合や，保持しているゲームの数が maxGames に達している場合はそのエラーを返す．
+func (store *sessionStore) setTheme(id string, theme string, create func() (*Game, error)) error {
+	current, err := store.touch(id, create)
+	if err != nil {
+		return err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	current.theme = theme
+
+	return nil
+}
+
+// id のセッションのプレイヤーが選んだテーマの名前を戻り値として返す．
+//
+// まだ選んでいない場合やセッションが無い場合は，既定のテーマを返す．
+func (store *sessionStore) theme(id string) string {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if current, ok := store.sessions[id]; ok {
+		return current.theme
+	}
+	return defaultTheme
+}
+
+// id のセッションで date の日替わりの盤面の成績を記録することを記録し，その日に初めて記録する場合に限り true を返す．
+//
+// 同じ日の盤面を繰り返し遊んで成績を重ねて記録できないよう，2回目以降やセッションが無い場合は false を返す．
+func (store *sessionStore) recordDaily(id string, date string) bool {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	current, ok := store.sessions[id]
+	if !ok || current.dailyRecorded == date {
+		return false
+	}
+	current.dailyRecorded = date
+	return true
+}
+
+// トークンが token のゲームを持つセッションのプレイヤーが最後に名乗った名前を戻り値として返す．
+//
+// まだ名乗っていない場合やそのようなゲームが無い場合は，空文字列を返す．
+func (store *sessionStore) playerNameForToken(token string) string {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if current, ok := store.sessions[store.tokens[token]]; ok {
+		return current.playerName
+	}
+	return ""
+}
+
+// トークンが token のゲームを取り出し，同じセッションの他のリクエストを排他した状態で fn に渡す．
+//
+// そのようなゲームが無い場合は fn を呼ばずに false を返す．
+func (store *sessionStore) lookupToken(token string, fn func(game *Game)) bool {
+	store.mutex.Lock()
+	id, ok := store.tokens[token]
+	var current *session
+	if ok {
+		current = store.sessions[id]
+		current.lastSeen = time.Now()
+	}
+	store.mutex.Unlock()
+	if !ok {
+		return false
+	}
+
+	current.mutex.Lock()
+	defer current.mutex.Unlock()
+
+	// 索引を引いてから排他するまでの間に，ゲームが置き換えられている場合がある．
+	if current.game.Token != token {
+		return false
+	}
+	fn(current.game)
+
+	return true
+}
+
+// id のゲームを，create で作成したゲームに置き換える．
+//
+// create には現在のゲームが渡される．ゲームが無い場合は nil が渡される．
+// 置き換えられた古いゲームへの参照は残さない．create が失敗した場合は現在のゲームを残してエラーを返す．
+// 保持しているゲームの数が maxGames に達している場合は，置き換えずに errTooManyGames を返す．
+func (store *sessionStore) replace(id string, create func(current *Game) (*Game, error)) (*Game, error) {
+	var created *Game
+	current, err := store.touch(id, func() (*Game, error) {
+		game, err := create(nil)
+		created = game
+		return game, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if created != nil {
+		return created, nil
+	}
+
+	current.mutex.Lock()
+	defer current.mutex.Unlock()
+
+	game, err := create(current.game)
+	if err != nil {
+		return nil, err
+	}
+
+	// トークンの索引を更新する．その間に掃除されていた場合は，使われているセッションとして登録し直す．
+	// 登録し直すことで maxGames を超える場合は，置き換えずに errTooManyGames を返す．
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	existing, ok := store.sessions[id]
+	if !ok && store.maxGames > 0 && len(store.sessions) >= store.maxGames {
+		return nil, errTooManyGames
+	}
+	current.game = game
+	delete(store.tokens, current.token)
+	if ok && existing != current {
+		delete(store.tokens, existing.token)
+	}
+	current.token = game.Token
+	store.sessions[id] = current
+	store.tokens[game.Token] = id
+
+	return game, nil
+}
+
+// maxIdle より長く参照されていないセッションを削除し，削除した数を戻り値として返す．
+func (store *sessionStore) sweep(maxIdle time.Duration) int {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	swept := 0
+	for id, current := range store.sessions {
+		if time.Since(current.lastSeen) > maxIdle {
+			store.remove(id)
+			swept++
+		}
+	}
+	return swept
+}
+
+// interval ごとに maxIdle より長く参照されていないセッションを削除するゴルーチンを起動する．
+//
+// 戻り値の関数を呼ぶと，ゴルーチンを停止してその終了を待つ．
+func (store *sessionStore) startSweeper(interval time.Duration, maxIdle time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-ticker.C:
+				if swept := store.sweep(maxIdle); swept > 0 {
+					logDebug("Swept", swept, "idle sessions")
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+		<-stopped
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+// 同じセッションから並行に送られた多数のめくりが1回ずつ直列に処理され，手数と揃った組の数が食い違わないことを確認する．
+func TestConcurrentFlipsOnOneGame(t *testing.T) {
+	const (
+		workers        = 16
+		flipsPerWorker = 40
+	)
+	server := newTestServer(t, newTestConfig(t))
+	client := server.newClient()
+
+	var created newGameResponse
+	decodeBody(t, server.do(client, http.MethodPost, "/api/new", nil), &created)
+	var cards int
+	server.app.sessions.lookupToken(created.Token, func(game *Game) {
+		cards = len(game.Board.Cards)
+	})
+
+	// 成功しためくりのうち，2枚目をめくったものと組が揃ったものを数える．
+	var mutex sync.Mutex
+	var flipped, secondFlips, matched int
+	var waitGroup sync.WaitGroup
+	for worker := range workers {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for i := range flipsPerWorker {
+				data, _ := json.Marshal(flipRequest{Card: (worker*7 + i*5) % cards})
+				response, err := client.Post(server.server.URL+"/api/flip", "application/json", bytes.NewReader(data))
+				if err != nil {
+					t.Errorf("POST /api/flip: %v", err)
+					return
+				}
+				var body flipResponse
+				err = json.NewDecoder(response.Body).Decode(&body)
+				response.Body.Close()
+				if response.StatusCode == http.StatusConflict {
+					continue
+				}
+				if response.StatusCode != http.StatusOK || err != nil {
+					t.Errorf("POST /api/flip: status %d, %v", response.StatusCode, err)
+					return
+				}
+
+				faceUp := 0
+				for _, card := range body.Cards {
+					if card.FaceUp {
+						faceUp++
+					}
+				}
+				mutex.Lock()
+				flipped++
+				if body.JustMatched || faceUp == 2 {
+					secondFlips++
+				}
+				if body.JustMatched {
+					matched++
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+	waitGroup.Wait()
+
+	found := server.app.sessions.lookupToken(created.Token, func(game *Game) {
+		if game.Moves != secondFlips {
+			t.Errorf("moves = %d, want %d second flips", game.Moves, secondFlips)
+		}
+		if game.Matches != matched {
+			t.Errorf("matches = %d, want %d matching flips", game.Matches, matched)
+		}
+		if len(game.Replay) != flipped {
+			t.Errorf("replay has %d flips, want %d successful flips", len(game.Replay), flipped)
+		}
+		matchedCards := 0
+		for _, card := range game.Board.Cards {
+			if card.Matched {
+				matchedCards++
+			}
+		}
+		if matchedCards != 2*game.Matches {
+			t.Errorf("%d cards are matched, want %d", matchedCards, 2*game.Matches)
+		}
+	})
+	if !found {
+		t.Fatal("the game was replaced while flipping")
+	}
+	if got := server.app.metrics.flips.Load(); got != int64(flipped) {
+		t.Errorf("flips metric = %d, want %d", got, flipped)
+	}
+}
+
+// 置き換えの途中でセッションが掃除され，その間に他のゲームで maxGames に達した場合は，登録し直さずに errTooManyGames を返すことを確認する．
+func TestReplaceSweptSessionRespectsMaxGames(t *testing.T) {
+	store := newSessionStore(1)
+	_, err := store.replace("first", func(*Game) (*Game, error) { return &Game{Token: "old"}, nil })
+	if err != nil {
+		t.Fatalf("creating the first game: %v", err)
+	}
+
+	_, err = store.replace("first", func(current *Game) (*Game, error) {
+		store.mutex.Lock()
+		store.remove("first")
+		store.mutex.Unlock()
+		_, err := store.touch("second", func() (*Game, error) { return &Game{Token: "other"}, nil })
+		if err != nil {
+			t.Fatalf("creating the second game: %v", err)
+		}
+		return &Game{Token: "new"}, nil
+	})
+	if err != errTooManyGames {
+		t.Errorf("replace after sweeping: %v, want %v", err, errTooManyGames)
+	}
+	if got := store.count(); got != 1 {
+		t.Errorf("count = %d, want 1", got)
+	}
+	if store.lookupToken("new", func(*Game) {}) {
+		t.Error("the replacing game was registered")
+	}
+}
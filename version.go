@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+)
+
+// ビルド時に -ldflags で埋め込むビルドの情報．
+//
+// 例えば以下のように指定する．指定しなかった場合は既定値のままとなる．
+//
+//	go build -ldflags "-X main.version=1.0.0 -X main.commit=$(git rev-parse HEAD) -X main.buildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildTime = "unknown"
+)
+
+// GET /version のレスポンスの形式．
+type versionResponse struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"buildTime"`
+	GoVersion string `json:"goVersion"`
+}
+
+// GET /version を処理し，動作しているサーバーのビルドの情報を JSON として返す．
+func versionHandler(writer http.ResponseWriter, request *http.Request) {
+	writeJSON(writer, http.StatusOK, versionResponse{
+		Version:   version,
+		Commit:    commit,
+		BuildTime: buildTime,
+		GoVersion: runtime.Version(),
+	})
+}